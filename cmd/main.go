@@ -18,7 +18,13 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name X-API-KEY
+// @description Named API key; its scopes decide which routes it may call.
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description OIDC access token of the company identity provider, as "Bearer <JWT>".
 // @security ApiKeyAuth
+// @security BearerAuth
 
 func main() {
 	if err := godotenv.Load(".env"); err != nil {
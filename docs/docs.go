@@ -20,9 +20,12 @@ const docTemplate = `{
                 "security": [
                     {
                         "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
-                "description": "Get customers from Erply. Get from cache, if not exist then from Erply Api.",
+                "description": "Get one page of customers from Erply. Get from cache, if no in cache then get from Erply Api.\nSend ` + "`" + `Cache-Control: no-cache` + "`" + ` to fetch from Erply, or ` + "`" + `max-age=N` + "`" + ` to accept cached data up to N seconds old.",
                 "consumes": [
                     "application/json"
                 ],
@@ -33,19 +36,197 @@ const docTemplate = `{
                     "customers"
                 ],
                 "summary": "Fetch Customers",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Page number, starting from 1",
+                        "name": "pageNo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size, 1-100",
+                        "name": "recordsOnPage",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search by customer name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by email",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by phone",
+                        "name": "phone",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by customer code",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by customer group ID",
+                        "name": "groupID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only customers changed since this unix timestamp",
+                        "name": "changedSince",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "no-cache or max-age=N",
+                        "name": "Cache-Control",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/api.CustomerListResponse"
+                        },
+                        "headers": {
+                            "Age": {
+                                "type": "integer",
+                                "description": "Age of the data in seconds"
+                            },
+                            "X-Cache": {
+                                "type": "string",
+                                "description": "HIT, MISS or STALE"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create a single customer in Erply",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Create Customer",
+                "parameters": [
+                    {
+                        "description": "Customer to create",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.SaveCustomer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.CustomerResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     }
                 }
@@ -56,9 +237,12 @@ const docTemplate = `{
                 "security": [
                     {
                         "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
-                "description": "Delete one or more customers by their IDs  example({\"customerIDs\": [\"4\", \"5\", \"6\"]}",
+                "description": "Delete one or more customers by their IDs  example({\"customerIDs\": [\"4\", \"5\", \"6\"]}\nReturns a result per ID. Status is 207 when some of the customers could not be deleted. When none\ncould be, it is the status of their errors (e.g. 404) with the same body.\nAt most 5000 IDs per request, sent to Erply in chunks of 100.",
                 "consumes": [
                     "application/json"
                 ],
@@ -84,22 +268,151 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/service.BulkResponse"
+                        }
+                    },
+                    "207": {
+                        "description": "Multi-Status",
+                        "schema": {
+                            "$ref": "#/definitions/service.BulkResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/customers/export": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Stream every customer matching the filters as NDJSON, one customer per line.\nPages are read from Erply 10 at a time, bypassing the cache. X-Total-Count holds the number of customers.\nIf Erply fails after streaming has started, the last line is {\"error\": {...}}.",
+                "produces": [
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Export Customers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search by customer name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by email",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by phone",
+                        "name": "phone",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by customer code",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by customer group ID",
+                        "name": "groupID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only customers changed since this unix timestamp",
+                        "name": "changedSince",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.Customer"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     }
                 }
@@ -110,9 +423,12 @@ const docTemplate = `{
                 "security": [
                     {
                         "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
-                "description": "Create or update customers in Erply",
+                "description": "Create or update customers in Erply\nReturns a result per customer. Status is 207 when some of the customers could not be saved. When none\ncould be, it is the status of their errors (e.g. 422) with the same body.\nAt most 5000 customers per request, sent to Erply in chunks of 100.",
                 "consumes": [
                     "application/json"
                 ],
@@ -122,7 +438,7 @@ const docTemplate = `{
                 "tags": [
                     "customers"
                 ],
-                "summary": "Save Customers",
+                "summary": "Save Customers. Json example can be found in the project json folder",
                 "parameters": [
                     {
                         "description": "Customers to save",
@@ -138,52 +454,561 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/service.BulkResponse"
+                        }
+                    },
+                    "207": {
+                        "description": "Multi-Status",
+                        "schema": {
+                            "$ref": "#/definitions/service.BulkResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     }
                 }
             }
         },
-        "/health": {
+        "/api/customers/{id}": {
             "get": {
-                "description": "Simple healthcheck endpoint",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get a single customer by ID. Get from cache, if no in cache then get from Erply Api.\nSend ` + "`" + `Cache-Control: no-cache` + "`" + ` to fetch from Erply, or ` + "`" + `max-age=N` + "`" + ` to accept cached data up to N seconds old.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "customers"
+                ],
+                "summary": "Fetch Customer",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Customer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "no-cache or max-age=N",
+                        "name": "Cache-Control",
+                        "in": "header"
+                    }
                 ],
-                "summary": "Returns health status",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/api.CustomerResponse"
+                        },
+                        "headers": {
+                            "Age": {
+                                "type": "integer",
+                                "description": "Age of the data in seconds"
+                            },
+                            "X-Cache": {
+                                "type": "string",
+                                "description": "HIT, MISS or STALE"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "api.DeleteRequest": {
-            "type": "object",
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replace all fields of an existing customer. Fields left out are cleared.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Replace Customer",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Customer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New customer data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.SaveCustomer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.CustomerResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete a single customer by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Delete Customer",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Customer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update only the given fields of an existing customer",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "customers"
+                ],
+                "summary": "Update Customer",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Customer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to update",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.SaveCustomer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.CustomerResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/api.AuthError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/erplyerr.Body"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Simple healthcheck endpoint. The status is degraded while the cache is down; requests are still\nserved from Erply then.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Returns health status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/health/live": {
+            "get": {
+                "description": "Returns 200 while the process serves HTTP. It checks no dependencies.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/health/ready": {
+            "get": {
+                "description": "Checks Redis and Erply (reachability and session validity) and reports each with its latency,\nplus the build info and the Erply request quota left this hour. Erply results are reused for a while\nso probes do not use up the API quota.\nReturns 503 when a required dependency is down.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.Readiness"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/service.Readiness"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "description": "Erply request quota of the current hour, in the Prometheus text format.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Metrics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.AuthError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "Forbidden"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "DELETE /api/customers/:id needs role admin, apikey:billing has role editor"
+                }
+            }
+        },
+        "api.CustomerListResponse": {
+            "type": "object",
+            "properties": {
+                "customers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.Customer"
+                    }
+                },
+                "links": {
+                    "$ref": "#/definitions/api.PageLinks"
+                },
+                "meta": {
+                    "$ref": "#/definitions/api.ResponseMeta"
+                },
+                "pageNo": {
+                    "type": "integer"
+                },
+                "recordsOnPage": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.CustomerResponse": {
+            "type": "object",
+            "properties": {
+                "customer": {
+                    "$ref": "#/definitions/service.Customer"
+                },
+                "meta": {
+                    "$ref": "#/definitions/api.ResponseMeta"
+                }
+            }
+        },
+        "api.DeleteRequest": {
+            "type": "object",
             "properties": {
                 "customerIDs": {
                     "type": "array",
@@ -191,46 +1016,474 @@ const docTemplate = `{
                 }
             }
         },
-        "api.SaveCustomer": {
+        "api.PageLinks": {
+            "type": "object",
+            "properties": {
+                "next": {
+                    "type": "string"
+                },
+                "previous": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseMeta": {
+            "type": "object",
+            "properties": {
+                "fetchedAt": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string",
+                    "enum": [
+                        "cache",
+                        "upstream",
+                        "stale"
+                    ]
+                },
+                "ttl": {
+                    "description": "cache TTL in seconds, 0 when not cached",
+                    "type": "integer",
+                    "example": 600
+                }
+            }
+        },
+        "api.SaveRequest": {
+            "type": "object",
+            "properties": {
+                "customers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.SaveCustomer"
+                    }
+                }
+            }
+        },
+        "erplyerr.Body": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "not_found"
+                },
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "customer not found"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "violations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/erplyerr.Violation"
+                    }
+                }
+            }
+        },
+        "erplyerr.Violation": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string",
+                    "example": "email"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "must be a valid email address"
+                },
+                "rule": {
+                    "type": "string",
+                    "example": "email"
+                }
+            }
+        },
+        "quota.Status": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "queued": {
+                    "description": "Queued and Rejected count the calls this instance delayed and refused\nsince it started.",
+                    "type": "integer"
+                },
+                "rejected": {
+                    "type": "integer"
+                },
+                "remaining": {
+                    "type": "integer"
+                },
+                "resetAt": {
+                    "type": "string"
+                },
+                "shared": {
+                    "description": "Shared is false while the counter fails and calls are counted per\ninstance.",
+                    "type": "boolean"
+                },
+                "used": {
+                    "type": "integer"
+                }
+            }
+        },
+        "service.BuildInfo": {
+            "type": "object",
+            "properties": {
+                "buildTime": {
+                    "type": "string"
+                },
+                "commit": {
+                    "type": "string"
+                },
+                "goVersion": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.BulkResponse": {
             "type": "object",
             "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.ItemResult"
+                    }
+                },
+                "summary": {
+                    "$ref": "#/definitions/service.BulkSummary"
+                }
+            }
+        },
+        "service.BulkSummary": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "succeeded": {
+                    "type": "integer"
+                }
+            }
+        },
+        "service.Customer": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "attributes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.CustomerAttribute"
+                    }
+                },
+                "birthday": {
+                    "type": "string"
+                },
+                "code": {
+                    "type": "string"
+                },
                 "companyName": {
                     "type": "string"
                 },
-                "customerID": {
+                "creditLimit": {
                     "type": "integer"
                 },
                 "email": {
                     "type": "string"
                 },
+                "emailEnabled": {
+                    "type": "boolean"
+                },
+                "emailOptOut": {
+                    "type": "boolean"
+                },
+                "fax": {
+                    "type": "string"
+                },
                 "firstName": {
                     "type": "string"
                 },
+                "fullName": {
+                    "type": "string"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "groupID": {
+                    "type": "integer"
+                },
+                "groupName": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastModified": {
+                    "type": "integer"
+                },
                 "lastName": {
                     "type": "string"
                 },
+                "mailEnabled": {
+                    "type": "boolean"
+                },
+                "mobile": {
+                    "type": "string"
+                },
+                "notes": {
+                    "type": "string"
+                },
+                "paymentDays": {
+                    "type": "integer"
+                },
                 "phone": {
                     "type": "string"
+                },
+                "taxExempt": {
+                    "type": "boolean"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "vatNumber": {
+                    "type": "string"
                 }
             }
         },
-        "api.SaveRequest": {
+        "service.CustomerAttribute": {
             "type": "object",
+            "required": [
+                "name"
+            ],
             "properties": {
-                "customers": {
+                "name": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "text",
+                        "int",
+                        "double"
+                    ],
+                    "example": "text"
+                },
+                "value": {
+                    "type": "string",
+                    "maxLength": 255
+                }
+            }
+        },
+        "service.DependencyStatus": {
+            "type": "object",
+            "properties": {
+                "checkedAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "latencyMs": {
+                    "type": "integer"
+                },
+                "required": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "up",
+                        "degraded",
+                        "down"
+                    ]
+                }
+            }
+        },
+        "service.ItemResult": {
+            "type": "object",
+            "properties": {
+                "customerID": {
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "Error is the error code of a failed item, as in error responses, e.g.\nupstream_quota_exhausted.",
+                    "type": "string"
+                },
+                "errorCode": {
+                    "type": "integer"
+                },
+                "field": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "retryAfter": {
+                    "description": "RetryAfter is in how many seconds a failed item may be retried, when\nthat is known.",
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "created",
+                        "updated",
+                        "deleted",
+                        "not_found",
+                        "failed"
+                    ]
+                }
+            }
+        },
+        "service.Readiness": {
+            "type": "object",
+            "properties": {
+                "build": {
+                    "$ref": "#/definitions/service.BuildInfo"
+                },
+                "dependencies": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/service.DependencyStatus"
+                    }
+                },
+                "erplyQuota": {
+                    "description": "ErplyQuota is the Erply request quota of the current hour, when it is\ntracked. It does not affect the status.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/quota.Status"
+                        }
+                    ]
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "ready",
+                        "not_ready"
+                    ]
+                }
+            }
+        },
+        "service.SaveCustomer": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "attributes": {
                     "type": "array",
+                    "maxItems": 50,
                     "items": {
-                        "$ref": "#/definitions/api.SaveCustomer"
+                        "$ref": "#/definitions/service.CustomerAttribute"
                     }
+                },
+                "birthday": {
+                    "type": "string",
+                    "example": "1990-12-31"
+                },
+                "code": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "companyName": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "creditLimit": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "customerID": {
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "email": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "emailEnabled": {
+                    "type": "boolean"
+                },
+                "emailOptOut": {
+                    "type": "boolean"
+                },
+                "fax": {
+                    "type": "string"
+                },
+                "firstName": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "gender": {
+                    "type": "string",
+                    "enum": [
+                        "male",
+                        "female"
+                    ]
+                },
+                "groupID": {
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "lastName": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "mailEnabled": {
+                    "type": "boolean"
+                },
+                "mobile": {
+                    "type": "string"
+                },
+                "notes": {
+                    "type": "string",
+                    "maxLength": 2000
+                },
+                "paymentDays": {
+                    "type": "integer",
+                    "maximum": 365,
+                    "minimum": 0
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "taxExempt": {
+                    "type": "boolean"
+                },
+                "vatNumber": {
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "website": {
+                    "type": "string",
+                    "maxLength": 255
                 }
             }
         }
     },
     "securityDefinitions": {
         "ApiKeyAuth": {
+            "description": "Named API key; its scopes decide which routes it may call.",
             "type": "apiKey",
             "name": "X-API-KEY",
             "in": "header"
+        },
+        "BearerAuth": {
+            "description": "OIDC access token of the company identity provider, as \"Bearer \u003cJWT\u003e\".",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
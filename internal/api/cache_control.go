@@ -0,0 +1,50 @@
+package api
+
+import (
+	"erply_test/internal/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOptions takes the cache directives of a read from the Cache-Control
+// request header. no-cache forces an upstream fetch, max-age=N accepts cached
+// data up to N seconds old. Other directives are ignored.
+func readOptions(c *gin.Context) service.ReadOptions {
+	var opts service.ReadOptions
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			opts.NoCache = true
+		case "max-age":
+			secs, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || secs < 0 {
+				continue
+			}
+			maxAge := time.Duration(secs) * time.Second
+			opts.MaxAge = &maxAge
+		}
+	}
+	return opts
+}
+
+// setCacheHeaders tells the client where a read was served from (X-Cache:
+// HIT, MISS or STALE) and how old the data is in seconds (Age).
+func setCacheHeaders(c *gin.Context, source string, fetchedAt time.Time) {
+	status := "MISS"
+	switch source {
+	case service.SourceCache:
+		status = "HIT"
+	case service.SourceStale:
+		status = "STALE"
+	}
+	age := 0
+	if source != service.SourceUpstream {
+		age = max(int(time.Since(fetchedAt).Seconds()), 0)
+	}
+	c.Header("X-Cache", status)
+	c.Header("Age", strconv.Itoa(age))
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"erply_test/internal/service"
+	"time"
+)
+
+type PageLinks struct {
+	Next     string `json:"next,omitempty"`
+	Previous string `json:"previous,omitempty"`
+}
+
+type ResponseMeta struct {
+	Source    string    `json:"source" enums:"cache,upstream,stale"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	TTL       int       `json:"ttl" example:"600"` // cache TTL in seconds, 0 when not cached
+}
+
+// AuthError is the body of 401 and 403 responses. Reason says which scope
+// or role a 403 was missing.
+type AuthError struct {
+	Error  string `json:"error" example:"Forbidden"`
+	Reason string `json:"reason,omitempty" example:"DELETE /api/customers/:id needs role admin, apikey:billing has role editor"`
+}
+
+type CustomerListResponse struct {
+	Customers     []service.Customer `json:"customers"`
+	Total         int                `json:"total"`
+	PageNo        int                `json:"pageNo"`
+	RecordsOnPage int                `json:"recordsOnPage"`
+	Links         PageLinks          `json:"links"`
+	Meta          ResponseMeta       `json:"meta"`
+}
+
+type CustomerResponse struct {
+	Customer service.Customer `json:"customer"`
+	Meta     ResponseMeta     `json:"meta"`
+}
+
+func newResponseMeta(source string, fetchedAt time.Time, policy service.CachePolicy) ResponseMeta {
+	meta := ResponseMeta{
+		Source:    source,
+		FetchedAt: fetchedAt,
+	}
+	if policy.Enabled {
+		meta.TTL = int(policy.TTL.Seconds())
+	}
+	return meta
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/middleware"
+	"erply_test/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportError is written as the last line of an export that failed after
+// streaming had started.
+type ExportError struct {
+	Error erplyerr.Body `json:"error"`
+}
+
+// ExportCustomers godoc
+// @Summary     Export Customers
+// @Description Stream every customer matching the filters as NDJSON, one customer per line.
+// @Description Pages are read from Erply 10 at a time, bypassing the cache. X-Total-Count holds the number of customers.
+// @Description If Erply fails after streaming has started, the last line is {"error": {...}}.
+// @Tags        customers
+// @Produce     application/x-ndjson
+// @Param       name          query string false "Search by customer name"
+// @Param       email         query string false "Filter by email"
+// @Param       phone         query string false "Filter by phone"
+// @Param       code          query string false "Filter by customer code"
+// @Param       groupID       query int    false "Filter by customer group ID"
+// @Param       changedSince  query int    false "Only customers changed since this unix timestamp"
+// @Success     200 {object} service.Customer
+// @Failure     400 {object} erplyerr.Body
+// @Failure     401 {object} AuthError
+// @Failure     403 {object} AuthError
+// @Failure     429 {object} erplyerr.Body
+// @Failure     500 {object} erplyerr.Body
+// @Failure     503 {object} erplyerr.Body
+// @Router      /api/customers/export [get]
+// @Security    ApiKeyAuth
+// @Security    BearerAuth
+func (h *APIHandler) ExportCustomers(c *gin.Context) {
+	var params CustomerListQuery
+	if err := c.ShouldBindQuery(&params); err != nil {
+		h.respondError(c, erplyerr.BadRequest("invalid query parameters: "+err.Error()))
+		return
+	}
+
+	// The request context is cancelled when the client disconnects.
+	ctx := c.Request.Context()
+	enc := json.NewEncoder(c.Writer)
+	started := false
+	err := h.customers.ExportCustomers(ctx, params.listQuery(), func(total int, batch []service.Customer) error {
+		if !started {
+			c.Header("X-Total-Count", strconv.Itoa(total))
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		for _, cust := range batch {
+			if err := enc.Encode(cust); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		h.logger.Info("customer export cancelled by client")
+	case !started:
+		h.logger.Error("error exporting customers", "error", err)
+		h.respondError(c, err)
+	default:
+		h.logger.Error("error exporting customers", "error", err)
+		e := erplyerr.From(err)
+		_ = enc.Encode(ExportError{Error: e.Body(c.GetString(middleware.RequestIDKey))})
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/service"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCustomer godoc
+// @Summary     Fetch Customer
+// @Description Get a single customer by ID. Get from cache, if no in cache then get from Erply Api.
+// @Description Send `Cache-Control: no-cache` to fetch from Erply, or `max-age=N` to accept cached data up to N seconds old.
+// @Tags        customers
+// @Produce     json
+// @Param       id            path   int    true  "Customer ID"
+// @Param       Cache-Control header string false "no-cache or max-age=N"
+// @Success     200 {object} CustomerResponse
+// @Header      200 {string} X-Cache "HIT, MISS or STALE"
+// @Header      200 {integer} Age "Age of the data in seconds"
+// @Failure     400 {object} erplyerr.Body
+// @Failure     401 {object} AuthError
+// @Failure     403 {object} AuthError
+// @Failure     429 {object} erplyerr.Body
+// @Failure     404 {object} erplyerr.Body
+// @Failure     500 {object} erplyerr.Body
+// @Failure     503 {object} erplyerr.Body
+// @Router      /api/customers/{id} [get]
+// @Security    ApiKeyAuth
+// @Security    BearerAuth
+func (h *APIHandler) GetCustomer(c *gin.Context) {
+	ctx, cancel := h.createTimeoutContext(c, 10*time.Second)
+	defer cancel()
+
+	id, ok := h.customerIDParam(c)
+	if !ok {
+		return
+	}
+
+	entry, source, err := h.customers.GetCustomer(ctx, id, readOptions(c))
+	if err != nil {
+		h.logger.Error("error fetching customer", "error", err)
+		h.respondError(c, err)
+		return
+	}
+
+	setCacheHeaders(c, source, entry.FetchedAt)
+	c.JSON(http.StatusOK, CustomerResponse{
+		Customer: entry.Customer,
+		Meta:     newResponseMeta(source, entry.FetchedAt, h.customers.CustomerCache()),
+	})
+}
+
+// CreateCustomer godoc
+// @Summary     Create Customer
+// @Description Create a single customer in Erply
+// @Tags        customers
+// @Accept      json
+// @Produce     json
+// @Param       request body     service.SaveCustomer true "Customer to create"
+// @Success     201     {object} CustomerResponse
+// @Failure     400     {object} erplyerr.Body
+// @Failure     401     {object} AuthError
+// @Failure     403     {object} AuthError
+// @Failure     429     {object} erplyerr.Body
+// @Failure     422     {object} erplyerr.Body
+// @Failure     500     {object} erplyerr.Body
+// @Failure     503     {object} erplyerr.Body
+// @Router      /api/customers [post]
+// @Security    ApiKeyAuth
+// @Security    BearerAuth
+func (h *APIHandler) CreateCustomer(c *gin.Context) {
+	ctx, cancel := h.createTimeoutContext(c, 10*time.Second)
+	defer cancel()
+
+	var cust service.SaveCustomer
+	if err := c.ShouldBindJSON(&cust); err != nil {
+		h.logger.Error("invalid json for create request", "error", err)
+		h.respondError(c, erplyerr.BadRequest("invalid request payload"))
+		return
+	}
+
+	id, err := h.customers.CreateCustomer(ctx, cust)
+	if err != nil {
+		h.logger.Error("error creating customer", "error", err)
+		h.respondError(c, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/customers/%d", id))
+	h.respondWithCustomer(c, ctx, id, http.StatusCreated)
+}
+
+// ReplaceCustomer godoc
+// @Summary     Replace Customer
+// @Description Replace all fields of an existing customer. Fields left out are cleared.
+// @Tags        customers
+// @Accept      json
+// @Produce     json
+// @Param       id      path     int          true "Customer ID"
+// @Param       request body     service.SaveCustomer true "New customer data"
+// @Success     200     {object} CustomerResponse
+// @Failure     400     {object} erplyerr.Body
+// @Failure     401     {object} AuthError
+// @Failure     403     {object} AuthError
+// @Failure     429     {object} erplyerr.Body
+// @Failure     404     {object} erplyerr.Body
+// @Failure     422     {object} erplyerr.Body
+// @Failure     500     {object} erplyerr.Body
+// @Failure     503     {object} erplyerr.Body
+// @Router      /api/customers/{id} [put]
+// @Security    ApiKeyAuth
+// @Security    BearerAuth
+func (h *APIHandler) ReplaceCustomer(c *gin.Context) {
+	h.updateCustomer(c, h.customers.ReplaceCustomer)
+}
+
+// PatchCustomer godoc
+// @Summary     Update Customer
+// @Description Update only the given fields of an existing customer
+// @Tags        customers
+// @Accept      json
+// @Produce     json
+// @Param       id      path     int          true "Customer ID"
+// @Param       request body     service.SaveCustomer true "Fields to update"
+// @Success     200     {object} CustomerResponse
+// @Failure     400     {object} erplyerr.Body
+// @Failure     401     {object} AuthError
+// @Failure     403     {object} AuthError
+// @Failure     429     {object} erplyerr.Body
+// @Failure     404     {object} erplyerr.Body
+// @Failure     422     {object} erplyerr.Body
+// @Failure     500     {object} erplyerr.Body
+// @Failure     503     {object} erplyerr.Body
+// @Router      /api/customers/{id} [patch]
+// @Security    ApiKeyAuth
+// @Security    BearerAuth
+func (h *APIHandler) PatchCustomer(c *gin.Context) {
+	h.updateCustomer(c, h.customers.PatchCustomer)
+}
+
+// DeleteCustomer godoc
+// @Summary     Delete Customer
+// @Description Delete a single customer by ID
+// @Tags        customers
+// @Produce     json
+// @Param       id  path int true "Customer ID"
+// @Success     204
+// @Failure     400 {object} erplyerr.Body
+// @Failure     401 {object} AuthError
+// @Failure     403 {object} AuthError
+// @Failure     429 {object} erplyerr.Body
+// @Failure     404 {object} erplyerr.Body
+// @Failure     500 {object} erplyerr.Body
+// @Failure     503 {object} erplyerr.Body
+// @Router      /api/customers/{id} [delete]
+// @Security    ApiKeyAuth
+// @Security    BearerAuth
+func (h *APIHandler) DeleteCustomer(c *gin.Context) {
+	ctx, cancel := h.createTimeoutContext(c, 10*time.Second)
+	defer cancel()
+
+	id, ok := h.customerIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.customers.DeleteCustomer(ctx, id); err != nil {
+		if !erplyerr.Is(err, erplyerr.KindNotFound) {
+			h.logger.Error("error deleting customer", "error", err)
+		}
+		h.respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// updateCustomer binds the customer given in the URL and body and saves it
+// with update.
+func (h *APIHandler) updateCustomer(c *gin.Context, update func(context.Context, int, service.SaveCustomer) error) {
+	ctx, cancel := h.createTimeoutContext(c, 10*time.Second)
+	defer cancel()
+
+	id, ok := h.customerIDParam(c)
+	if !ok {
+		return
+	}
+
+	var cust service.SaveCustomer
+	if err := c.ShouldBindJSON(&cust); err != nil {
+		h.logger.Error("invalid json for update request", "error", err)
+		h.respondError(c, erplyerr.BadRequest("invalid request payload"))
+		return
+	}
+
+	if err := update(ctx, id, cust); err != nil {
+		h.logger.Error("error updating customer", "error", err)
+		h.respondError(c, err)
+		return
+	}
+
+	h.respondWithCustomer(c, ctx, id, http.StatusOK)
+}
+
+// respondWithCustomer reads the saved customer back, which also caches it for
+// the next read, and writes it with the given status. The write succeeded, so
+// if the read fails the response still has the usual shape, with only the ID
+// and an empty meta.
+func (h *APIHandler) respondWithCustomer(c *gin.Context, ctx context.Context, id int, status int) {
+	entry, source, err := h.customers.GetCustomer(ctx, id, service.ReadOptions{})
+	if err != nil {
+		h.logger.Error("error reading saved customer", "error", err)
+		c.JSON(status, CustomerResponse{Customer: service.Customer{ID: id}})
+		return
+	}
+	c.JSON(status, CustomerResponse{
+		Customer: entry.Customer,
+		Meta:     newResponseMeta(source, entry.FetchedAt, h.customers.CustomerCache()),
+	})
+}
+
+// customerIDParam parses the :id path parameter. On failure it writes a 400
+// response and returns false.
+func (h *APIHandler) customerIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		h.respondError(c, erplyerr.BadRequest("invalid customer ID"))
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"erply_test/internal/service"
+	"fmt"
+)
+
+// CustomerListQuery holds the query parameters accepted by GET /api/customers.
+type CustomerListQuery struct {
+	PageNo        int    `form:"pageNo" binding:"omitempty,min=1"`
+	RecordsOnPage int    `form:"recordsOnPage" binding:"omitempty,min=1,max=100"`
+	Name          string `form:"name" binding:"omitempty,max=255"`
+	Email         string `form:"email" binding:"omitempty,max=255"`
+	Phone         string `form:"phone" binding:"omitempty,max=50"`
+	Code          string `form:"code" binding:"omitempty,max=100"`
+	GroupID       int    `form:"groupID" binding:"omitempty,min=1"`
+	ChangedSince  int64  `form:"changedSince" binding:"omitempty,min=1"`
+}
+
+// listQuery converts the query parameters into a service query with the
+// defaults applied.
+func (q CustomerListQuery) listQuery() service.ListQuery {
+	query := service.ListQuery{
+		PageNo:        q.PageNo,
+		RecordsOnPage: q.RecordsOnPage,
+		Name:          q.Name,
+		Email:         q.Email,
+		Phone:         q.Phone,
+		Code:          q.Code,
+		GroupID:       q.GroupID,
+		ChangedSince:  q.ChangedSince,
+	}
+	query.ApplyDefaults()
+	return query
+}
+
+// pageLinks returns next/previous links for the page described by query.
+func pageLinks(path string, query service.ListQuery, total int) PageLinks {
+	var links PageLinks
+	if query.PageNo*query.RecordsOnPage < total {
+		links.Next = pageLink(path, query, query.PageNo+1)
+	}
+	if query.PageNo > 1 {
+		links.Previous = pageLink(path, query, query.PageNo-1)
+	}
+	return links
+}
+
+// pageLink builds a link to the given page of the same listing.
+func pageLink(path string, query service.ListQuery, pageNo int) string {
+	query.PageNo = pageNo
+	return fmt.Sprintf("%s?%s", path, query.Values().Encode())
+}
@@ -2,12 +2,13 @@ package api
 
 import (
 	"context"
-	"encoding/json"
+	"erply_test/internal/erplyerr"
 	"erply_test/internal/logger"
-	cache "erply_test/internal/repository"
+	"erply_test/internal/middleware"
+	"erply_test/internal/service"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,234 +19,204 @@ type DeleteRequest struct {
 }
 
 type SaveRequest struct {
-	Customers []SaveCustomer `json:"customers"`
-}
-
-type SaveCustomer struct {
-	CustomerID  *int   `json:"customerID,omitempty"`
-	FirstName   string `json:"firstName,omitempty"`
-	LastName    string `json:"lastName,omitempty"`
-	CompanyName string `json:"companyName,omitempty"`
-	Email       string `json:"email,omitempty"`
-	Phone       string `json:"phone,omitempty"`
+	Customers []service.SaveCustomer `json:"customers"`
 }
 
 type APIHandler struct {
-	router          *gin.Engine
-	logger          logger.LoggerInterface
-	customerManager CustomerManagerInterface
-	cache           cache.CacheInterface
+	router    *gin.Engine
+	logger    logger.LoggerInterface
+	customers *service.CustomerService
 }
 
 func NewHandler(
 	router *gin.Engine,
 	logger logger.LoggerInterface,
-	customerManager CustomerManagerInterface,
-	cache cache.CacheInterface,
+	customers *service.CustomerService,
 ) *APIHandler {
 	return &APIHandler{
-		router:          router,
-		logger:          logger,
-		customerManager: customerManager,
-		cache:           cache,
+		router:    router,
+		logger:    logger,
+		customers: customers,
 	}
 }
 
 // GetHealth godoc
 // @Summary     Returns health status
-// @Description Simple healthcheck endpoint
+// @Description Simple healthcheck endpoint. The status is degraded while the cache is down; requests are still
+// @Description served from Erply then.
 // @Tags        health
 // @Produce     json
 // @Success     200 {object} map[string]interface{}
 // @Router      /health [get]
 func (h *APIHandler) GetHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "good"})
+	if !h.customers.CacheHealthy() {
+		c.JSON(http.StatusOK, gin.H{"status": "degraded", "cache": "down"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "good", "cache": "up"})
 }
 
 // GetCustomers godoc
 // @Summary     Fetch Customers
-// @Description Get customers from Erply. Get from cache, if no in cache then get from Erply Api.
+// @Description Get one page of customers from Erply. Get from cache, if no in cache then get from Erply Api.
+// @Description Send `Cache-Control: no-cache` to fetch from Erply, or `max-age=N` to accept cached data up to N seconds old.
 // @Tags        customers
 // @Accept      json
 // @Produce     json
-// @Success     200 {object} map[string]interface{}
-// @Failure     500 {object} map[string]interface{}
+// @Param       pageNo        query int    false "Page number, starting from 1" default(1)
+// @Param       recordsOnPage query int    false "Page size, 1-100" default(20)
+// @Param       name          query string false "Search by customer name"
+// @Param       email         query string false "Filter by email"
+// @Param       phone         query string false "Filter by phone"
+// @Param       code          query string false "Filter by customer code"
+// @Param       groupID       query int    false "Filter by customer group ID"
+// @Param       changedSince  query int    false "Only customers changed since this unix timestamp"
+// @Param       Cache-Control header string false "no-cache or max-age=N"
+// @Success     200 {object} CustomerListResponse
+// @Header      200 {string} X-Cache "HIT, MISS or STALE"
+// @Header      200 {integer} Age "Age of the data in seconds"
+// @Failure     400 {object} erplyerr.Body
+// @Failure     401 {object} AuthError
+// @Failure     403 {object} AuthError
+// @Failure     429 {object} erplyerr.Body
+// @Failure     500 {object} erplyerr.Body
+// @Failure     503 {object} erplyerr.Body
 // @Router      /api/customers [get]
 // @Security    ApiKeyAuth
+// @Security    BearerAuth
 func (h *APIHandler) GetCustomers(c *gin.Context) {
-	ctx := h.createTimeoutContext(c, 10*time.Second)
+	ctx, cancel := h.createTimeoutContext(c, 10*time.Second)
+	defer cancel()
 
-	cacheKey := "customers"
-	val, err := h.cache.Get(ctx, cacheKey)
-	if err != nil {
-		h.logger.Error("error getting from cache", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var params CustomerListQuery
+	if err := c.ShouldBindQuery(&params); err != nil {
+		h.respondError(c, erplyerr.BadRequest("invalid query parameters: "+err.Error()))
 		return
 	}
+	query := params.listQuery()
 
-	if val == "" {
-		// If not found in cache, fetch from Erply
-		bulkFilters := []map[string]interface{}{
-			{
-				// "recordsOnPage": recordsOnPageStr,
-				// "pageNo":        pageNoStr,
-			},
-		}
-		customersResp, err := h.customerManager.GetCustomersBulk(ctx, bulkFilters, map[string]string{})
-		if err != nil {
-			h.logger.Error("error fetching customers", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		customersJSON, err := json.Marshal(customersResp)
-		if err != nil {
-			h.logger.Error("error marshalling customers", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if err := h.cache.Set(ctx, cacheKey, string(customersJSON), 10*time.Minute); err != nil {
-			h.logger.Error("error caching customers", err)
-		}
-		val = string(customersJSON)
+	page, source, err := h.customers.ListCustomers(ctx, query, readOptions(c))
+	if err != nil {
+		h.logger.Error("error fetching customers", "error", err)
+		h.respondError(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"customers": val,
+	setCacheHeaders(c, source, page.FetchedAt)
+	c.JSON(http.StatusOK, CustomerListResponse{
+		Customers:     page.Customers,
+		Total:         page.Total,
+		PageNo:        query.PageNo,
+		RecordsOnPage: query.RecordsOnPage,
+		Links:         pageLinks(c.Request.URL.Path, query, page.Total),
+		Meta:          newResponseMeta(source, page.FetchedAt, h.customers.ListCache()),
 	})
 }
 
 // DeleteCustomers godoc
 // @Summary     Delete Customers
 // @Description Delete one or more customers by their IDs  example({"customerIDs": ["4", "5", "6"]}
+// @Description Returns a result per ID. Status is 207 when some of the customers could not be deleted. When none
+// @Description could be, it is the status of their errors (e.g. 404) with the same body.
+// @Description At most 5000 IDs per request, sent to Erply in chunks of 100.
 // @Tags        customers
 // @Accept      json
 // @Produce     json
 // @Param       request body DeleteRequest true "Delete request")
-// @Success     200 {object} map[string]interface{}
-// @Failure     400 {object} map[string]interface{}
-// @Failure     500 {object} map[string]interface{}
+// @Success     200 {object} service.BulkResponse
+// @Success     207 {object} service.BulkResponse
+// @Failure     400 {object} erplyerr.Body
+// @Failure     401 {object} AuthError
+// @Failure     403 {object} AuthError
+// @Failure     429 {object} erplyerr.Body
+// @Failure     500 {object} erplyerr.Body
+// @Failure     503 {object} erplyerr.Body
 // @Router      /api/customers/delete [delete]
 // @Security    ApiKeyAuth
+// @Security    BearerAuth
 func (h *APIHandler) DeleteCustomers(c *gin.Context) {
-	ctx := h.createTimeoutContext(c, 10*time.Second)
-
 	var req DeleteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Error("invalid json for delete request", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		h.logger.Error("invalid json for delete request", "error", err)
+		h.respondError(c, erplyerr.BadRequest("invalid request payload"))
 		return
 	}
 
-	if len(req.CustomerIDs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no customer IDs provided"})
+	ids, err := service.ParseCustomerIDs(req.CustomerIDs)
+	if err != nil {
+		h.respondError(c, err)
 		return
 	}
 
-	var bulkReq []map[string]interface{}
-	for _, id := range req.CustomerIDs {
-		var idStr string
-		switch v := id.(type) {
-		case float64:
-			idStr = strconv.Itoa(int(v))
-		case string:
-			idStr = v
-		default:
-			h.logger.Error("invalid customer ID type", nil)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID type"})
-			return
-		}
-
-		h.logger.Info("Deleting customerID: " + idStr)
-		bulkReq = append(bulkReq, map[string]interface{}{
-			"customerID": idStr,
-		})
-	}
-
-	deleteResp, err := h.customerManager.DeleteCustomerBulk(ctx, bulkReq, map[string]string{})
+	resp, err := h.customers.DeleteCustomers(c.Request.Context(), ids)
 	if err != nil {
-		//`Invalid classifier ID, there is no such item. (Attribute "errorField" indicates the invalid input parameter.)`, from Erply-go-wrapper
-		if strings.Contains(err.Error(), "1011") {
-			h.logger.Warn("Customer already deleted or invalid ID")
-			c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "Some customers were already deleted.", "response": deleteResp})
-			return
-		}
-		h.logger.Error("error deleting customers", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "customerIDs": req.CustomerIDs})
+		h.logger.Error("error deleting customers", "error", err)
+		h.respondError(c, err)
 		return
 	}
-	cacheKey := "customers"
-	h.cache.Delete(ctx, cacheKey)
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "response": deleteResp})
+	h.respondBulk(c, resp)
 }
 
 // SaveCustomers godoc
 // @Summary     Save Customers. Json example can be found in the project json folder
 // @Description Create or update customers in Erply
+// @Description Returns a result per customer. Status is 207 when some of the customers could not be saved. When none
+// @Description could be, it is the status of their errors (e.g. 422) with the same body.
+// @Description At most 5000 customers per request, sent to Erply in chunks of 100.
 // @Tags        customers
 // @Accept      json
 // @Produce     json
 // @Param       request body SaveRequest true "Customers to save"
-// @Success     200 {object} map[string]interface{}
-// @Failure     400 {object} map[string]interface{}
-// @Failure     500 {object} map[string]interface{}
+// @Success     200 {object} service.BulkResponse
+// @Success     207 {object} service.BulkResponse
+// @Failure     400 {object} erplyerr.Body
+// @Failure     401 {object} AuthError
+// @Failure     403 {object} AuthError
+// @Failure     429 {object} erplyerr.Body
+// @Failure     422 {object} erplyerr.Body
+// @Failure     500 {object} erplyerr.Body
+// @Failure     503 {object} erplyerr.Body
 // @Router      /api/customers/save [post]
 // @Security    ApiKeyAuth
+// @Security    BearerAuth
 func (h *APIHandler) SaveCustomers(c *gin.Context) {
-	ctx := h.createTimeoutContext(c, 10*time.Second)
-
 	var req SaveRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Error("invalid json for save request", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		h.logger.Error("invalid json for save request", "error", err)
+		h.respondError(c, erplyerr.BadRequest("invalid request payload"))
 		return
 	}
 
-	if len(req.Customers) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no customers to save"})
+	resp, err := h.customers.SaveCustomers(c.Request.Context(), req.Customers)
+	if err != nil {
+		h.logger.Error("error saving customers", "error", err)
+		h.respondError(c, err)
 		return
 	}
 
-	var bulk []map[string]interface{}
-	for _, cust := range req.Customers {
-		m := map[string]interface{}{}
-		if cust.CustomerID != nil {
-			m["customerID"] = *cust.CustomerID
-		}
-		if cust.FirstName != "" {
-			m["firstName"] = cust.FirstName
-		}
-		if cust.LastName != "" {
-			m["lastName"] = cust.LastName
-		}
-		if cust.CompanyName != "" {
-			m["companyName"] = cust.CompanyName
-		}
-		if cust.Email != "" {
-			m["email"] = cust.Email
-		}
-		if cust.Phone != "" {
-			m["phone"] = cust.Phone
-		}
-		bulk = append(bulk, m)
-	}
+	h.respondBulk(c, resp)
+}
 
-	resp, err := h.customerManager.SaveCustomerBulk(ctx, bulk, map[string]string{})
-	if err != nil {
-		h.logger.Error("error saving customers", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// respondBulk writes a bulk response, which keeps its per-item results when
+// no item succeeded.
+func (h *APIHandler) respondBulk(c *gin.Context, resp service.BulkResponse) {
+	if retryAfter := resp.RetryAfter(); retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 	}
+	c.JSON(resp.HTTPStatus(), resp)
+}
 
-	cacheKey := "customers"
-	h.cache.Delete(ctx, cacheKey)
-
-	c.JSON(http.StatusOK, resp)
+// respondError writes err as a JSON error body with the status of its kind.
+// Errors that are not classified yet are treated as Erply client errors.
+func (h *APIHandler) respondError(c *gin.Context, err error) {
+	e := erplyerr.From(err)
+	if e.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+	c.JSON(e.HTTPStatus(), e.Body(c.GetString(middleware.RequestIDKey)))
 }
 
-func (h *APIHandler) createTimeoutContext(c *gin.Context, ttl time.Duration) context.Context {
-	ctx, _ := context.WithTimeout(c.Request.Context(), ttl)
-	return ctx
+func (h *APIHandler) createTimeoutContext(c *gin.Context, ttl time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), ttl)
 }
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"erply_test/internal/quota"
+	"erply_test/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	health *service.HealthService
+	quota  *quota.Governor
+}
+
+// NewHealthHandler reports the Erply quota of g in the readiness probe. g may
+// be nil.
+func NewHealthHandler(health *service.HealthService, g *quota.Governor) *HealthHandler {
+	return &HealthHandler{health: health, quota: g}
+}
+
+// GetLive godoc
+// @Summary     Liveness probe
+// @Description Returns 200 while the process serves HTTP. It checks no dependencies.
+// @Tags        health
+// @Produce     json
+// @Success     200 {object} map[string]interface{}
+// @Router      /health/live [get]
+func (h *HealthHandler) GetLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive", "version": h.health.Build().Version})
+}
+
+// GetReady godoc
+// @Summary     Readiness probe
+// @Description Checks Redis and Erply (reachability and session validity) and reports each with its latency,
+// @Description plus the build info and the Erply request quota left this hour. Erply results are reused for a while
+// @Description so probes do not use up the API quota.
+// @Description Returns 503 when a required dependency is down.
+// @Tags        health
+// @Produce     json
+// @Success     200 {object} service.Readiness
+// @Failure     503 {object} service.Readiness
+// @Router      /health/ready [get]
+func (h *HealthHandler) GetReady(c *gin.Context) {
+	ready := h.health.Ready(c.Request.Context())
+	if h.quota != nil {
+		status := h.quota.Status(c.Request.Context())
+		ready.ErplyQuota = &status
+	}
+	code := http.StatusOK
+	if ready.Status != service.StatusReady {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, ready)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"erply_test/internal/quota"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	quota *quota.Governor
+}
+
+func NewMetricsHandler(g *quota.Governor) *MetricsHandler {
+	return &MetricsHandler{quota: g}
+}
+
+// GetMetrics godoc
+// @Summary     Metrics
+// @Description Erply request quota of the current hour, in the Prometheus text format.
+// @Tags        health
+// @Produce     plain
+// @Success     200 {string} string
+// @Router      /metrics [get]
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	var b strings.Builder
+	if h.quota != nil {
+		s := h.quota.Status(c.Request.Context())
+		metric(&b, "erply_quota_limit", "gauge", "Erply requests allowed per hour.", s.Limit)
+		metric(&b, "erply_quota_used", "gauge", "Erply requests sent this hour, by all instances.", s.Used)
+		metric(&b, "erply_quota_remaining", "gauge", "Erply requests left this hour.", s.Remaining)
+		metric(&b, "erply_quota_reset_seconds", "gauge", "Seconds until the Erply quota resets.", int(time.Until(s.ResetAt).Seconds()))
+		metric(&b, "erply_quota_queued_total", "counter", "Erply calls this instance delayed to pace the quota.", s.Queued)
+		metric(&b, "erply_quota_rejected_total", "counter", "Erply calls this instance refused for lack of quota.", s.Rejected)
+		shared := 0
+		if s.Shared {
+			shared = 1
+		}
+		metric(&b, "erply_quota_shared", "gauge", "1 while the quota is counted in Redis for all instances, 0 while per instance.", shared)
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+func metric[T int | int64](b *strings.Builder, name, kind, help string, value T) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
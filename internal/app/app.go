@@ -3,10 +3,20 @@ package app
 import (
 	"context"
 	hapi "erply_test/internal/api"
+	"erply_test/internal/auth"
 	"erply_test/internal/logger"
 	"erply_test/internal/middleware"
+	"erply_test/internal/quota"
+	"erply_test/internal/ratelimit"
 	cache "erply_test/internal/repository"
+	"erply_test/internal/service"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "erply_test/docs"
 
@@ -25,85 +35,463 @@ type App struct {
 	router      *gin.Engine
 	logger      logger.LoggerInterface
 	cache       cache.CacheInterface
-	ctx         context.Context
 	erplyClient *api.Client
+	erplyHTTP   *http.Client
 	handler     *hapi.APIHandler
+	health      *hapi.HealthHandler
+	metrics     *hapi.MetricsHandler
+	keys        *auth.KeyStore
+	tokens      *auth.JWTVerifier
+	limiter     *ratelimit.Limiter
+	ipLimiter   *ratelimit.Limiter
+	// redis is the connection shared by the cache, the API keys, the rate
+	// limiters and the Erply quota, or nil when none of them uses Redis.
+	redis redis.UniversalClient
 }
 
 type Config struct {
-	RedisAddr         string `env:"REDIS_ADDR"`
 	AppPort           string `env:"APP_PORT"`
 	AppHost           string `env:"APP_HOST"`
 	ERPLY_USER_NAME   string `env:"ERPLY_USER_NAME"`
 	ERPLY_USER_PASS   string `env:"ERPLY_USER_PASS"`
 	ERPLY_CLIENT_CODE string `env:"ERPLY_CLIENT_CODE"`
-	ApiKey            string `env:"API_KEY"`
+	// ApiKey is a single admin key with every scope, kept for existing
+	// clients.
+	ApiKey string `env:"API_KEY"`
+	// ApiKeysFile and ApiKeysRedisKey hold named, hashed, scoped keys in the
+	// format of auth.ParseAPIKeys, reloaded every ApiKeysReloadInterval.
+	ApiKeysFile           string        `env:"API_KEYS_FILE"`
+	ApiKeysRedisKey       string        `env:"API_KEYS_REDIS_KEY"`
+	ApiKeysReloadInterval time.Duration `env:"API_KEYS_RELOAD_INTERVAL" envDefault:"30s"`
+	// JWTJWKS enables bearer tokens: the file path or URL of the identity
+	// provider's JWKS. Tokens must carry JWTIssuer and JWTAudience.
+	JWTJWKS         string        `env:"JWT_JWKS"`
+	JWTJWKSCacheTTL time.Duration `env:"JWT_JWKS_CACHE_TTL" envDefault:"1h"`
+	JWTIssuer       string        `env:"JWT_ISSUER"`
+	JWTAudience     string        `env:"JWT_AUDIENCE"`
+	JWTLeeway       time.Duration `env:"JWT_LEEWAY" envDefault:"30s"`
+	// JWTScopeMap maps token scopes to ours, e.g. "crm.read=customers:read".
+	JWTScopeMap map[string]string `env:"JWT_SCOPE_MAP" envKeyValSeparator:"="`
+	// JWTRoleMap maps roles of the token's "roles" claim to read-only,
+	// editor or admin, e.g. "crm-admins=admin".
+	JWTRoleMap map[string]string `env:"JWT_ROLE_MAP" envKeyValSeparator:"="`
+	// Redis is the connection used by the redis and tiered cache drivers.
+	Redis cache.RedisConfig `envPrefix:"REDIS_"`
+	// CacheDriver is redis, tiered (in-process L1 in front of Redis), memory
+	// (in-process LRU) or none.
+	CacheDriver     string        `env:"CACHE_DRIVER" envDefault:"redis"`
+	CacheMaxEntries int           `env:"CACHE_MAX_ENTRIES" envDefault:"10000"`
+	CacheL1TTL      time.Duration `env:"CACHE_L1_TTL" envDefault:"30s"`
+	// CacheStaleTTL is how long expired customers and listings are still
+	// served while they are refreshed. 0 disables stale-while-revalidate.
+	CacheStaleTTL time.Duration `env:"CACHE_STALE_TTL" envDefault:"0s"`
+	// Cache policies of GET /api/customers/:id and GET /api/customers.
+	CacheCustomerEnabled bool          `env:"CACHE_CUSTOMER_ENABLED" envDefault:"true"`
+	CacheCustomerTTL     time.Duration `env:"CACHE_CUSTOMER_TTL" envDefault:"10m"`
+	CacheListEnabled     bool          `env:"CACHE_LIST_ENABLED" envDefault:"true"`
+	CacheListTTL         time.Duration `env:"CACHE_LIST_TTL" envDefault:"10m"`
+	// CacheCompression is none, gzip or zstd. Values shorter than
+	// CacheCompressMinBytes are stored uncompressed.
+	CacheCompression      string `env:"CACHE_COMPRESSION" envDefault:"gzip"`
+	CacheCompressMinBytes int    `env:"CACHE_COMPRESS_MIN_BYTES" envDefault:"1024"`
+	// The redis and tiered caches are bypassed after CacheBreakerThreshold
+	// consecutive errors and probed every CacheBreakerCooldown until they
+	// answer again.
+	CacheBreakerThreshold int           `env:"CACHE_BREAKER_THRESHOLD" envDefault:"5"`
+	CacheBreakerCooldown  time.Duration `env:"CACHE_BREAKER_COOLDOWN" envDefault:"5s"`
+	// ShutdownTimeout is how long in-flight requests may run after SIGINT or
+	// SIGTERM before they are cut off.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	// Rate limits per client of /api, as "<count>/<s|m|h>". RateLimitRoutes
+	// sets limits of single routes, by "METHOD /path"; the other routes share
+	// RateLimitDefault. RateLimitIP limits each client IP before
+	// authentication, over all routes. RateLimitStore is redis (shared by
+	// replicas, per instance while Redis is down) or memory.
+	RateLimitEnabled bool              `env:"RATE_LIMIT_ENABLED" envDefault:"true"`
+	RateLimitStore   string            `env:"RATE_LIMIT_STORE" envDefault:"redis"`
+	RateLimitDefault string            `env:"RATE_LIMIT_DEFAULT" envDefault:"300/m"`
+	RateLimitRoutes  map[string]string `env:"RATE_LIMIT_ROUTES" envKeyValSeparator:"=" envDefault:"POST /api/customers/save=30/m,DELETE /api/customers/delete=30/m"`
+	RateLimitIP      string            `env:"RATE_LIMIT_IP" envDefault:"600/m"`
+	// TrustedProxies are the addresses or CIDRs of the proxies whose
+	// X-Forwarded-For names the client IP. By default none is trusted and the
+	// client IP is the peer address.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+	// ErplyHourlyLimit is the requests per hour Erply allows the account,
+	// counted by all replicas together; 0 stops counting. Once fewer than
+	// ErplyQuotaReserve are left, calls are spread over the rest of the hour
+	// and wait up to ErplyQuotaMaxWait for their turn. ErplyQuotaStore is
+	// redis (shared by replicas, per instance while Redis is down) or memory.
+	ErplyHourlyLimit  int           `env:"ERPLY_HOURLY_LIMIT" envDefault:"1000"`
+	ErplyQuotaReserve int           `env:"ERPLY_QUOTA_RESERVE" envDefault:"100"`
+	ErplyQuotaMaxWait time.Duration `env:"ERPLY_QUOTA_MAX_WAIT" envDefault:"2s"`
+	ErplyQuotaStore   string        `env:"ERPLY_QUOTA_STORE" envDefault:"redis"`
+	// HealthRequireCache makes /health/ready fail while Redis is down. By
+	// default Redis is optional, as requests then go to Erply.
+	HealthRequireCache bool `env:"HEALTH_REQUIRE_CACHE" envDefault:"false"`
+	// HealthErplyInterval is how long /health/ready reuses the Erply check.
+	HealthErplyInterval time.Duration `env:"HEALTH_ERPLY_INTERVAL" envDefault:"1m"`
 }
 
 func CreateApp(config *Config) *App {
 	fmt.Println()
-	logger := logger.NewSlogLogger()
-	ctx := context.Background()
+	erplyHTTP := newErplyHTTPClient()
+	erplyClient, err := api.NewClientFromCredentials(config.ERPLY_USER_NAME, config.ERPLY_USER_PASS, config.ERPLY_CLIENT_CODE, erplyHTTP)
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: config.RedisAddr,
-	})
+	if err != nil {
+		panic(err)
+	}
+	return NewApp(config, erplyClient, erplyHTTP)
+}
 
-	cache := cache.NewRedisCache(redisClient)
+// NewApp wires the app around an Erply client that is logged in already.
+// erplyHTTP is the client's HTTP client, whose connections are closed on
+// shutdown.
+func NewApp(config *Config, erplyClient *api.Client, erplyHTTP *http.Client) *App {
+	logger := logger.NewSlogLogger()
 
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		panic(fmt.Sprintf("Failed to connect to Redis: %v", err))
-	} else {
-		logger.Info("Connected to Redis!", nil)
+	codec, err := cache.NewCodec(config.CacheCompression, config.CacheCompressMinBytes)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid CACHE_COMPRESSION: %v", err))
 	}
 
-	erplyClient, err := api.NewClientFromCredentials(config.ERPLY_USER_NAME, config.ERPLY_USER_PASS, config.ERPLY_CLIENT_CODE, nil)
+	var redisClient redis.UniversalClient
+	if usesRedis(config) {
+		redisClient = newRedisClient(config)
+	}
+	store := newCache(config, redisClient, logger)
+	tokens := newTokenVerifier(config)
+	keys := newKeyStore(config, redisClient, logger, tokens != nil)
+	limiter, ipLimiter := newLimiters(config, redisClient, logger)
+	governor := newQuotaGovernor(config, redisClient, logger)
 
-	if err != nil {
-		panic(err)
+	router := NewRouter(config)
+
+	var customerManager service.CustomerManagerInterface = erplyClient.CustomerManager
+	erplyCheck := service.ErplySessionCheck(erplyClient.GetSession, config.ERPLY_CLIENT_CODE, erplyHTTP)
+	if governor != nil {
+		customerManager = service.WithQuota(customerManager, governor)
+		erplyCheck = service.CheckWithQuota(erplyCheck, governor)
 	}
 
-	var router = gin.Default()
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://127.0.0.1"},
-		AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "X-API-KEY"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
+	deps := []service.Dependency{{
+		Name:     "erply",
+		Required: true,
+		Check:    erplyCheck,
+		CacheFor: config.HealthErplyInterval,
+	}}
+	if pinger, ok := store.(cache.Pinger); ok {
+		deps = append(deps, service.Dependency{Name: "redis", Required: config.HealthRequireCache, Check: pinger.Ping})
+	}
+	if config.ApiKeysRedisKey != "" {
+		// Keys that only live in Redis are refused until they have loaded.
+		deps = append(deps, service.Dependency{Name: "api_keys", Required: true, Check: keys.Ready})
+	}
 
 	return &App{
 		config:      config,
 		router:      router,
-		cache:       cache,
+		cache:       store,
 		logger:      logger,
 		erplyClient: erplyClient,
-		handler:     hapi.NewHandler(router, logger, erplyClient.CustomerManager, cache),
+		erplyHTTP:   erplyHTTP,
+		keys:        keys,
+		limiter:     limiter,
+		ipLimiter:   ipLimiter,
+		redis:       redisClient,
+		tokens:      tokens,
+		handler: hapi.NewHandler(router, logger, service.NewCustomerService(customerManager, store, logger,
+			service.WithCodec(codec),
+			service.WithStaleWhileRevalidate(config.CacheStaleTTL),
+			service.WithCustomerCache(service.CachePolicy{Enabled: config.CacheCustomerEnabled, TTL: config.CacheCustomerTTL}),
+			service.WithListCache(service.CachePolicy{Enabled: config.CacheListEnabled, TTL: config.CacheListTTL}),
+		)),
+		health:  hapi.NewHealthHandler(service.NewHealthService(buildInfo(), deps...), governor),
+		metrics: hapi.NewMetricsHandler(governor),
+	}
+}
+
+// NewRouter creates the router with the middleware every route shares. Client
+// IPs are only taken from X-Forwarded-For of TRUSTED_PROXIES.
+func NewRouter(config *Config) *gin.Engine {
+	router := gin.Default()
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		panic(fmt.Sprintf("Invalid TRUSTED_PROXIES: %v", err))
+	}
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{"http://127.0.0.1"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Cache-Control", "Authorization", "X-API-KEY", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count", "X-Cache", "Age", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", middleware.RequestIDHeader},
+		AllowCredentials: true,
+	}))
+	return router
+}
+
+// newTokenVerifier returns the bearer token verifier, or nil when JWT_JWKS is
+// not set.
+func newTokenVerifier(config *Config) *auth.JWTVerifier {
+	if config.JWTJWKS == "" {
+		return nil
+	}
+	tokens, err := auth.NewJWTVerifier(auth.NewJWKS(config.JWTJWKS, nil, config.JWTJWKSCacheTTL), auth.JWTConfig{
+		Issuer:   config.JWTIssuer,
+		Audience: config.JWTAudience,
+		Leeway:   config.JWTLeeway,
+		ScopeMap: config.JWTScopeMap,
+		RoleMap:  config.JWTRoleMap,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Invalid JWT configuration: %v", err))
+	}
+	return tokens
+}
+
+// newKeyStore loads the API keys from API_KEY, API_KEYS_FILE and
+// API_KEYS_REDIS_KEY. Without bearer tokens at least one of them must be set.
+// If Redis is down at startup the store starts with the other keys and keeps
+// retrying Redis.
+func newKeyStore(config *Config, redisClient redis.UniversalClient, logger logger.LoggerInterface, bearer bool) *auth.KeyStore {
+	var sources auth.KeySources
+	if config.ApiKey != "" {
+		key := auth.NewAPIKey("default", config.ApiKey, auth.AllScopes...)
+		key.Role = auth.RoleAdmin
+		sources = append(sources, auth.StaticKeys{key})
+	}
+	if config.ApiKeysFile != "" {
+		sources = append(sources, auth.FileKeys(config.ApiKeysFile))
+	}
+	if len(sources) == 0 && config.ApiKeysRedisKey == "" && !bearer {
+		panic("No API keys configured, set API_KEY, API_KEYS_FILE, API_KEYS_REDIS_KEY or JWT_JWKS")
+	}
+
+	var keys *auth.KeyStore
+	var err error
+	if config.ApiKeysRedisKey != "" {
+		redisKeys := auth.RedisKeys{Client: redisClient, Key: config.ApiKeysRedisKey}
+		keys, err = auth.StartKeyStore(append(sources, redisKeys), sources, logger, config.ApiKeysReloadInterval)
+	} else {
+		keys, err = auth.NewKeyStore(sources, logger, config.ApiKeysReloadInterval)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// newLimiters creates the per-client and the per-IP rate limiter, or nils
+// when rate limiting is off.
+func newLimiters(config *Config, redisClient redis.UniversalClient, logger logger.LoggerInterface) (*ratelimit.Limiter, *ratelimit.Limiter) {
+	if !config.RateLimitEnabled {
+		return nil, nil
+	}
+	limits := ratelimit.Limits{Routes: map[string]ratelimit.Limit{}}
+	var ipLimits ratelimit.Limits
+	var err error
+	if limits.Default, err = ratelimit.ParseLimit(config.RateLimitDefault); err != nil {
+		panic(fmt.Sprintf("Invalid RATE_LIMIT_DEFAULT: %v", err))
+	}
+	for route, value := range config.RateLimitRoutes {
+		if limits.Routes[route], err = ratelimit.ParseLimit(value); err != nil {
+			panic(fmt.Sprintf("Invalid RATE_LIMIT_ROUTES entry %q: %v", route, err))
+		}
+	}
+	if ipLimits.Default, err = ratelimit.ParseLimit(config.RateLimitIP); err != nil {
+		panic(fmt.Sprintf("Invalid RATE_LIMIT_IP: %v", err))
+	}
+
+	switch config.RateLimitStore {
+	case "redis":
+		if redisClient == nil {
+			logger.Info("No Redis configured, rate limiting per instance")
+			return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limits, logger),
+				ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ipLimits, logger)
+		}
+		return ratelimit.NewLimiter(ratelimit.NewRedisStore(redisClient, "ratelimit:"), limits, logger),
+			ratelimit.NewLimiter(ratelimit.NewRedisStore(redisClient, "ratelimit:ip:"), ipLimits, logger)
+	case "memory":
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limits, logger),
+			ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ipLimits, logger)
+	default:
+		panic(fmt.Sprintf("Unknown RATE_LIMIT_STORE %q, expected redis or memory", config.RateLimitStore))
+	}
+}
+
+// newQuotaGovernor creates the Erply quota governor, or nil when
+// ERPLY_HOURLY_LIMIT is 0.
+func newQuotaGovernor(config *Config, redisClient redis.UniversalClient, logger logger.LoggerInterface) *quota.Governor {
+	if config.ErplyHourlyLimit <= 0 {
+		return nil
+	}
+	cfg := quota.Config{Limit: config.ErplyHourlyLimit, Reserve: config.ErplyQuotaReserve, MaxWait: config.ErplyQuotaMaxWait}
+	switch config.ErplyQuotaStore {
+	case "redis":
+		if redisClient == nil {
+			logger.Info("No Redis configured, counting the Erply quota per instance")
+			return quota.NewGovernor(quota.NewMemoryCounter(), config.ERPLY_CLIENT_CODE, cfg, logger)
+		}
+		return quota.NewGovernor(quota.NewRedisCounter(redisClient, "erply:quota:"), config.ERPLY_CLIENT_CODE, cfg, logger)
+	case "memory":
+		return quota.NewGovernor(quota.NewMemoryCounter(), config.ERPLY_CLIENT_CODE, cfg, logger)
+	default:
+		panic(fmt.Sprintf("Unknown ERPLY_QUOTA_STORE %q, expected redis or memory", config.ErplyQuotaStore))
+	}
+}
+
+// usesRedis reports whether the cache or the API keys need Redis, or the rate
+// limiters or the Erply quota are set to use it and a Redis server is
+// configured. Without one they fall back to counting per instance.
+func usesRedis(config *Config) bool {
+	if config.CacheDriver == "redis" || config.CacheDriver == "tiered" || config.ApiKeysRedisKey != "" {
+		return true
+	}
+	configured := config.Redis.URL != "" || len(config.Redis.Addrs) > 0
+	return configured && ((config.RateLimitEnabled && config.RateLimitStore == "redis") ||
+		(config.ErplyHourlyLimit > 0 && config.ErplyQuotaStore == "redis"))
+}
+
+// erplyResponseTimeout bounds how long Erply may take to answer a call. It
+// fits the longest call, a bulk export or save; each call's context sets its
+// own, usually shorter, budget.
+const erplyResponseTimeout = 30 * time.Second
+
+// newErplyHTTPClient has the Erply SDK's connection settings, without its
+// overall timeout of 5s, which would cut off bulk calls the service gives
+// more time. The app keeps it to close its connections on shutdown.
+func newErplyHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 10 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 4 * time.Second,
+			ResponseHeaderTimeout: erplyResponseTimeout,
+			MaxIdleConns:          25,
+			MaxConnsPerHost:       25,
+		},
 	}
 }
 
+// cacheInvalidationChannel is the Redis pub/sub channel the tiered cache uses
+// to evict L1 entries on all instances.
+const cacheInvalidationChannel = "cache:invalidate"
+
+// newCache creates the cache selected by CACHE_DRIVER.
+func newCache(config *Config, redisClient redis.UniversalClient, logger logger.LoggerInterface) cache.CacheInterface {
+	switch config.CacheDriver {
+	case "redis":
+		return withBreaker(cache.NewRedisCache(redisClient), config, logger)
+	case "tiered":
+		logger.Info("Using in-memory L1 cache", "maxEntries", config.CacheMaxEntries, "ttl", config.CacheL1TTL)
+		return withBreaker(cache.NewTieredCache(
+			cache.NewMemoryCache(config.CacheMaxEntries, time.Minute),
+			cache.NewRedisCache(redisClient),
+			cache.NewRedisInvalidationBus(redisClient, cacheInvalidationChannel),
+			config.CacheL1TTL,
+		), config, logger)
+	case "memory":
+		logger.Info("Using in-memory cache", "maxEntries", config.CacheMaxEntries)
+		return cache.NewMemoryCache(config.CacheMaxEntries, time.Minute)
+	case "none":
+		logger.Info("Cache disabled")
+		return cache.NewNoopCache()
+	default:
+		panic(fmt.Sprintf("Unknown CACHE_DRIVER %q, expected redis, tiered, memory or none", config.CacheDriver))
+	}
+}
+
+// newRedisClient creates the Redis client. It does not connect, so the app
+// starts while Redis is down.
+func newRedisClient(config *Config) redis.UniversalClient {
+	redisClient, err := cache.NewRedisClient(config.Redis)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid Redis configuration: %v", err))
+	}
+	return redisClient
+}
+
+// withBreaker makes c a soft dependency: while it fails, requests bypass it.
+func withBreaker(c cache.PingableCache, config *Config, logger logger.LoggerInterface) cache.CacheInterface {
+	return cache.NewBreakerCache(c, logger, config.CacheBreakerThreshold, config.CacheBreakerCooldown)
+}
+
+// Run serves the API until SIGINT or SIGTERM, then drains in-flight requests
+// for up to ShutdownTimeout and shuts down.
 func (app *App) Run() {
 	defer app.Shutdown()
 
 	// ==========  Public routes  ==========
 	app.router.GET("/health", app.handler.GetHealth)
+	app.router.GET("/health/live", app.health.GetLive)
+	app.router.GET("/health/ready", app.health.GetReady)
+	app.router.GET("/metrics", app.metrics.GetMetrics)
 	app.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// ==========  Protected routes  ==========
 	protected := app.router.Group("/api")
-	protected.Use(middleware.APIKeyAuthMiddleware(app.config.ApiKey))
+	if app.ipLimiter != nil {
+		protected.Use(middleware.IPRateLimitMiddleware(app.ipLimiter))
+	}
+	protected.Use(middleware.AuthMiddleware(app.keys, app.tokens))
+	if app.limiter != nil {
+		protected.Use(middleware.RateLimitMiddleware(app.limiter))
+	}
 	{
-		protected.GET("/customers", app.handler.GetCustomers)
-		protected.DELETE("/customers/delete", app.handler.DeleteCustomers)
-		protected.POST("/customers/save", app.handler.SaveCustomers)
+		read := middleware.Authorize(app.logger, auth.ScopeCustomersRead, auth.RoleReadOnly)
+		write := middleware.Authorize(app.logger, auth.ScopeCustomersWrite, auth.RoleEditor)
+		del := middleware.Authorize(app.logger, auth.ScopeCustomersDelete, auth.RoleAdmin)
+
+		protected.GET("/customers", read, app.handler.GetCustomers)
+		protected.GET("/customers/export", read, app.handler.ExportCustomers)
+		protected.POST("/customers", write, app.handler.CreateCustomer)
+		protected.DELETE("/customers/delete", del, app.handler.DeleteCustomers)
+		protected.POST("/customers/save", write, app.handler.SaveCustomers)
+		protected.GET("/customers/:id", read, app.handler.GetCustomer)
+		protected.PUT("/customers/:id", write, app.handler.ReplaceCustomer)
+		protected.PATCH("/customers/:id", write, app.handler.PatchCustomer)
+		protected.DELETE("/customers/:id", del, app.handler.DeleteCustomer)
+	}
+
+	addr := app.config.AppHost + ":" + app.config.AppPort
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		app.logger.Error("Error listening", "addr", addr, "error", err)
+		return
 	}
 	app.logger.Info("App Running")
-	app.logger.Info(app.config.AppHost + ":" + app.config.AppPort)
-	app.router.Run(app.config.AppHost + ":" + app.config.AppPort)
+	app.logger.Info(addr)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Handler: app.router, ReadHeaderTimeout: 10 * time.Second}
+	// Draining restores the default signal handling, so a second SIGINT or
+	// SIGTERM kills the process right away.
+	defer context.AfterFunc(ctx, func() {
+		stop()
+		app.logger.Info("Shutting down, draining requests", "timeout", app.config.ShutdownTimeout)
+	})()
+	if err := Serve(ctx, srv, ln, app.config.ShutdownTimeout); err != nil {
+		app.logger.Error("Error stopping server", "error", err)
+	}
 }
 
+// Shutdown closes the cache and Redis, then the Erply connections, and
+// flushes the log.
 func (app *App) Shutdown() {
+	app.keys.Close()
 	if err := app.cache.Close(); err != nil {
-		app.logger.Error("Error closing Redis client", err)
+		app.logger.Error("Error closing cache", "error", err)
+	}
+	if app.redis != nil {
+		if err := app.redis.Close(); err != nil {
+			app.logger.Error("Error closing Redis", "error", err)
+		}
+	}
+	app.erplyHTTP.CloseIdleConnections()
+	app.logger.Info("App stopped")
+	if f, ok := app.logger.(logger.Flusher); ok {
+		f.Flush()
 	}
 }
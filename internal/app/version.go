@@ -0,0 +1,31 @@
+package app
+
+import (
+	"erply_test/internal/service"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+// go build -ldflags "-X erply_test/internal/app.Version=1.2.0 -X erply_test/internal/app.Commit=abc123".
+// Commit and BuildTime default to the VCS info Go embeds.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+func buildInfo() service.BuildInfo {
+	info := service.BuildInfo{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Scopes granted to API keys.
+const (
+	ScopeCustomersRead   = "customers:read"
+	ScopeCustomersWrite  = "customers:write"
+	ScopeCustomersDelete = "customers:delete"
+)
+
+// AllScopes is every scope, as held by the legacy API_KEY.
+var AllScopes = []string{ScopeCustomersRead, ScopeCustomersWrite, ScopeCustomersDelete}
+
+var (
+	ErrUnknownKey     = errors.New("invalid API key")
+	ErrKeyDisabled    = errors.New("API key disabled")
+	ErrKeyExpired     = errors.New("API key expired")
+	ErrKeyNotYetValid = errors.New("API key not yet valid")
+)
+
+// APIKey is a named client key. Only the SHA-256 of the secret is kept. For
+// rotation, give the new key the same name and a NotBefore before the old
+// key's ExpiresAt: both work while the windows overlap.
+type APIKey struct {
+	Name      string
+	Hash      [sha256.Size]byte
+	Role      Role
+	Scopes    []string
+	Enabled   bool
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
+
+// HashKey returns the hex SHA-256 of a secret, as stored in key files.
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey creates an enabled key for a plain secret, with the role its
+// scopes need.
+func NewAPIKey(name, secret string, scopes ...string) APIKey {
+	return APIKey{Name: name, Hash: sha256.Sum256([]byte(secret)), Role: RoleForScopes(scopes), Scopes: scopes, Enabled: true}
+}
+
+// valid reports why k cannot be used at now, if it cannot.
+func (k APIKey) valid(now time.Time) error {
+	switch {
+	case !k.Enabled:
+		return ErrKeyDisabled
+	case !k.NotBefore.IsZero() && now.Before(k.NotBefore):
+		return ErrKeyNotYetValid
+	case !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt):
+		return ErrKeyExpired
+	}
+	return nil
+}
+
+// matchKey finds the key whose hash matches secret. Every key is compared,
+// in constant time, so the timing does not tell which keys exist.
+func matchKey(keys []APIKey, secret string) (APIKey, bool) {
+	sum := sha256.Sum256([]byte(secret))
+	var found APIKey
+	ok := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare(sum[:], k.Hash[:]) == 1 {
+			found, ok = k, true
+		}
+	}
+	return found, ok
+}
+
+// keyFile is the JSON format of API key files and of the Redis key:
+//
+//	{"keys": [{"name": "billing", "hash": "<hex sha256>", "role": "editor", "scopes": ["customers:read"],
+//	           "enabled": true, "notBefore": "2025-01-01T00:00:00Z", "expiresAt": "2026-01-01T00:00:00Z"}]}
+type keyFile struct {
+	Keys []struct {
+		Name      string     `json:"name"`
+		Hash      string     `json:"hash"`
+		Role      string     `json:"role"`
+		Scopes    []string   `json:"scopes"`
+		Enabled   *bool      `json:"enabled"`
+		NotBefore *time.Time `json:"notBefore"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	} `json:"keys"`
+}
+
+// ParseAPIKeys reads a key file. Keys are enabled unless "enabled" is false,
+// and read-only unless they have a role.
+func ParseAPIKeys(data []byte) ([]APIKey, error) {
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid API key file: %w", err)
+	}
+	keys := make([]APIKey, 0, len(file.Keys))
+	for i, entry := range file.Keys {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("API key %d has no name", i)
+		}
+		hash, err := hex.DecodeString(entry.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be a hex SHA-256", entry.Name)
+		}
+		for _, scope := range entry.Scopes {
+			if !slices.Contains(AllScopes, scope) {
+				return nil, fmt.Errorf("API key %q: unknown scope %q", entry.Name, scope)
+			}
+		}
+		role := RoleForScopes(entry.Scopes)
+		if entry.Role != "" {
+			if role, err = ParseRole(entry.Role); err != nil {
+				return nil, fmt.Errorf("API key %q: %w", entry.Name, err)
+			}
+		}
+		key := APIKey{Name: entry.Name, Role: role, Scopes: entry.Scopes, Enabled: entry.Enabled == nil || *entry.Enabled}
+		copy(key.Hash[:], hash)
+		if entry.NotBefore != nil {
+			key.NotBefore = *entry.NotBefore
+		}
+		if entry.ExpiresAt != nil {
+			key.ExpiresAt = *entry.ExpiresAt
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	jwksFetchTimeout = 10 * time.Second
+	// jwksMinRefresh limits refetches for tokens signed with an unknown key
+	// ID, so made-up key IDs cannot make us hammer the identity provider.
+	jwksMinRefresh = time.Minute
+	// jwksRetry is how often a set that never loaded is refetched.
+	jwksRetry    = 5 * time.Second
+	jwksMaxBytes = 1 << 20
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// JWKS is a JSON Web Key Set read from a file or an http(s) URL. Keys are
+// cached for ttl, and refetched early when a token names an unknown key ID,
+// which is how identity providers roll their keys. Fetches run outside the
+// lock and concurrent ones are shared, so a slow provider only delays the
+// requests that need the new keys.
+type JWKS struct {
+	source string
+	client *http.Client
+	ttl    time.Duration
+	flight singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	err       error
+}
+
+func NewJWKS(source string, client *http.Client, ttl time.Duration) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: jwksFetchTimeout}
+	}
+	return &JWKS{source: source, client: client, ttl: ttl}
+}
+
+// Key returns the public key with key ID kid. An empty kid matches the only
+// key of a single-key set.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	keys, fetchedAt, err := j.current()
+	if keys == nil && time.Since(fetchedAt) < jwksRetry {
+		return nil, err
+	}
+	switch {
+	case keys == nil:
+		if keys, fetchedAt, err = j.refresh(ctx, fetchedAt); keys == nil {
+			return nil, err
+		}
+	case time.Since(fetchedAt) >= j.ttl:
+		// Expired keys are used until the new set arrives.
+		go j.refresh(context.Background(), fetchedAt)
+	}
+	if key, ok := lookup(keys, kid); ok {
+		return key, nil
+	}
+	if time.Since(fetchedAt) >= jwksMinRefresh {
+		if keys, _, err = j.refresh(ctx, fetchedAt); err != nil {
+			return nil, err
+		}
+		if key, ok := lookup(keys, kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownSigningKey, kid)
+}
+
+func (j *JWKS) current() (map[string]crypto.PublicKey, time.Time, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.keys, j.fetchedAt, j.err
+}
+
+func lookup(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// refresh fetches the set, unless it was fetched since seen, and returns
+// the keys in use after it. Callers share one fetch, which is not cancelled
+// when one of them gives up. On failure the keys fetched before stay in use
+// and fetchedAt is still bumped, so a failing provider is not retried on
+// every request.
+func (j *JWKS) refresh(ctx context.Context, seen time.Time) (map[string]crypto.PublicKey, time.Time, error) {
+	ch := j.flight.DoChan("refresh", func() (interface{}, error) {
+		if keys, fetchedAt, err := j.current(); fetchedAt.After(seen) {
+			return keys, err
+		}
+		data, err := j.fetch(context.WithoutCancel(ctx))
+		var keys map[string]crypto.PublicKey
+		if err == nil {
+			keys, err = ParseJWKS(data)
+		}
+		if err != nil {
+			err = fmt.Errorf("loading JWKS from %s: %w", j.source, err)
+		}
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if keys != nil {
+			j.keys = keys
+		}
+		j.fetchedAt = time.Now()
+		j.err = err
+		return j.keys, err
+	})
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return nil, time.Time{}, ctx.Err()
+	}
+	return j.current()
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(j.source)
+	}
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, jwksMaxBytes))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS reads the RSA, EC and Ed25519 signing keys of a JWKS document
+// by key ID. Other keys are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url number")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// JWTConfig describes which tokens JWTVerifier accepts.
+type JWTConfig struct {
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew allowed on exp, nbf and iat.
+	Leeway time.Duration
+	// ScopeMap maps identity provider scopes to ours. Scopes that are ours
+	// already pass as they are; others are dropped.
+	ScopeMap map[string]string
+	// RoleMap maps identity provider roles, from the "roles" claim, to ours
+	// in the same way.
+	RoleMap map[string]string
+}
+
+// JWTVerifier checks bearer tokens of the company identity provider.
+type JWTVerifier struct {
+	keys   *JWKS
+	config JWTConfig
+	parser *jwt.Parser
+}
+
+func NewJWTVerifier(keys *JWKS, config JWTConfig) (*JWTVerifier, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("JWT issuer and audience are required")
+	}
+	for from, to := range config.ScopeMap {
+		if !slices.Contains(AllScopes, to) {
+			return nil, fmt.Errorf("JWT scope %q maps to unknown scope %q", from, to)
+		}
+	}
+	for from, to := range config.RoleMap {
+		if _, err := ParseRole(to); err != nil {
+			return nil, fmt.Errorf("JWT role %q: %w", from, err)
+		}
+	}
+	return &JWTVerifier{
+		keys:   keys,
+		config: config,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithAudience(config.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(config.Leeway),
+		),
+	}, nil
+}
+
+// tokenClaims are the registered claims plus the scopes, which providers
+// send as a space-separated "scope" string or a "scp" list, and the roles.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope"`
+	Scp   []string `json:"scp"`
+	Roles []string `json:"roles"`
+}
+
+// Verify checks the signature, issuer, audience and expiry of token and
+// returns its principal.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	var claims tokenClaims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	scopes := v.scopes(claims)
+	role := v.role(claims)
+	if role == "" {
+		role = RoleForScopes(scopes)
+	}
+	return Principal{ID: "jwt:" + claims.Subject, Role: role, Scopes: scopes}, nil
+}
+
+// role returns the highest of the token's roles that is known, or none.
+func (v *JWTVerifier) role(claims tokenClaims) Role {
+	var best Role
+	for _, name := range claims.Roles {
+		if mapped, ok := v.config.RoleMap[name]; ok {
+			name = mapped
+		}
+		if role, err := ParseRole(name); err == nil && !best.Includes(role) {
+			best = role
+		}
+	}
+	return best
+}
+
+func (v *JWTVerifier) scopes(claims tokenClaims) []string {
+	var scopes []string
+	for _, scope := range append(strings.Fields(claims.Scope), claims.Scp...) {
+		if mapped, ok := v.config.ScopeMap[scope]; ok {
+			scope = mapped
+		}
+		if slices.Contains(AllScopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"erply_test/internal/logger"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyLoadTimeout = 5 * time.Second
+	// keyRetryInterval is how often StartKeyStore retries a source that
+	// failed at startup when keys are not reloaded otherwise.
+	keyRetryInterval = 10 * time.Second
+)
+
+// KeySource loads the current set of API keys.
+type KeySource interface {
+	Load(ctx context.Context) ([]APIKey, error)
+}
+
+// StaticKeys is a fixed set of keys.
+type StaticKeys []APIKey
+
+func (s StaticKeys) Load(ctx context.Context) ([]APIKey, error) {
+	return s, nil
+}
+
+// FileKeys reads keys from a JSON key file.
+type FileKeys string
+
+func (f FileKeys) Load(ctx context.Context) ([]APIKey, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	return ParseAPIKeys(data)
+}
+
+// RedisKeys reads keys from a Redis string holding a JSON key file, so all
+// replicas share one set.
+type RedisKeys struct {
+	Client redis.UniversalClient
+	Key    string
+}
+
+func (r RedisKeys) Load(ctx context.Context) ([]APIKey, error) {
+	data, err := r.Client.Get(ctx, r.Key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis key %q with API keys does not exist", r.Key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseAPIKeys(data)
+}
+
+// KeySources loads and concatenates several sources.
+type KeySources []KeySource
+
+func (s KeySources) Load(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	for _, source := range s {
+		loaded, err := source.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, loaded...)
+	}
+	return keys, nil
+}
+
+// KeyStore authenticates API keys. It reloads its source every interval; if
+// a reload fails, the keys loaded last stay in use.
+type KeyStore struct {
+	source   KeySource
+	logger   logger.LoggerInterface
+	interval time.Duration
+	keys     atomic.Pointer[[]APIKey]
+	// pending is why source has not loaded yet while fallback keys are in
+	// use.
+	pending atomic.Pointer[error]
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewKeyStore loads the keys once and fails if that fails. With an interval
+// above 0 the keys are then reloaded in the background until Close.
+func NewKeyStore(source KeySource, logger logger.LoggerInterface, interval time.Duration) (*KeyStore, error) {
+	s := newKeyStore(source, logger, interval)
+	if err := s.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	s.start()
+	return s, nil
+}
+
+// StartKeyStore is NewKeyStore for sources that may be down at startup, such
+// as Redis. If source fails to load, the store starts with the keys of
+// fallback, which must load, and retries source in the background; Ready
+// fails until it has loaded.
+func StartKeyStore(source, fallback KeySource, logger logger.LoggerInterface, interval time.Duration) (*KeyStore, error) {
+	s := newKeyStore(source, logger, interval)
+	err := s.Reload(context.Background())
+	if err != nil {
+		logger.Warn("Error loading API keys, starting with the fallback ones", "error", err)
+		keys, fallbackErr := fallback.Load(context.Background())
+		if fallbackErr != nil {
+			return nil, fmt.Errorf("loading fallback API keys: %w", fallbackErr)
+		}
+		s.keys.Store(&keys)
+		s.pending.Store(&err)
+		if s.interval <= 0 {
+			s.interval = keyRetryInterval
+		}
+	}
+	s.start()
+	return s, nil
+}
+
+func newKeyStore(source KeySource, logger logger.LoggerInterface, interval time.Duration) *KeyStore {
+	return &KeyStore{
+		source:   source,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *KeyStore) start() {
+	if s.interval > 0 {
+		go s.watch()
+	} else {
+		close(s.done)
+	}
+}
+
+// Authenticate returns the principal of secret, or why it was refused.
+func (s *KeyStore) Authenticate(secret string) (Principal, error) {
+	key, ok := matchKey(*s.keys.Load(), secret)
+	if !ok {
+		return Principal{}, ErrUnknownKey
+	}
+	if err := key.valid(time.Now()); err != nil {
+		return Principal{}, err
+	}
+	return Principal{ID: "apikey:" + key.Name, Role: key.Role, Scopes: key.Scopes}, nil
+}
+
+// Reload loads the keys from the source now.
+func (s *KeyStore) Reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, keyLoadTimeout)
+	defer cancel()
+	keys, err := s.source.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading API keys: %w", err)
+	}
+	if old := s.keys.Swap(&keys); old == nil || !reflect.DeepEqual(*old, keys) {
+		s.logger.Info("API keys loaded", "count", len(keys))
+	}
+	s.pending.Store(nil)
+	return nil
+}
+
+// Ready fails while the store runs on fallback keys because its source has
+// not loaded yet.
+func (s *KeyStore) Ready(ctx context.Context) error {
+	if err := s.pending.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (s *KeyStore) Close() {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *KeyStore) watch() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.Reload(context.Background()); err != nil {
+			s.logger.Warn("Error reloading API keys, keeping the current ones", "error", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Role is what a principal may do. Each role includes the ones before it:
+// read-only reads customers, editor also creates and updates them, admin also
+// deletes them.
+type Role string
+
+const (
+	RoleReadOnly Role = "read-only"
+	RoleEditor   Role = "editor"
+	RoleAdmin    Role = "admin"
+)
+
+var roleOrder = []Role{RoleReadOnly, RoleEditor, RoleAdmin}
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, error) {
+	if !slices.Contains(roleOrder, Role(s)) {
+		return "", fmt.Errorf("unknown role %q, expected read-only, editor or admin", s)
+	}
+	return Role(s), nil
+}
+
+// Includes reports whether r grants everything required grants. The empty
+// role includes nothing.
+func (r Role) Includes(required Role) bool {
+	have := slices.Index(roleOrder, r)
+	return have >= 0 && have >= slices.Index(roleOrder, required)
+}
+
+// RoleForScopes is the role of a key or token that names none: the least
+// role that can use all of its scopes, so credentials from before roles keep
+// working.
+func RoleForScopes(scopes []string) Role {
+	switch {
+	case slices.Contains(scopes, ScopeCustomersDelete):
+		return RoleAdmin
+	case slices.Contains(scopes, ScopeCustomersWrite):
+		return RoleEditor
+	default:
+		return RoleReadOnly
+	}
+}
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	// ID names the client, e.g. "apikey:billing".
+	ID     string
+	Role   Role
+	Scopes []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
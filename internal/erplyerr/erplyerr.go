@@ -0,0 +1,248 @@
+// Package erplyerr maps errors returned by the Erply API into a small set of
+// typed errors, each with its own HTTP status and a stable JSON body.
+package erplyerr
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+)
+
+// Kind is the error category. Its value is also the "code" sent to clients.
+type Kind string
+
+const (
+	KindBadRequest  Kind = "bad_request"
+	KindNotFound    Kind = "not_found"
+	KindValidation  Kind = "validation_error"
+	KindAuth        Kind = "upstream_auth_error"
+	KindRateLimited Kind = "rate_limited"
+	KindUnavailable Kind = "upstream_unavailable"
+	// KindQuotaExhausted means the account's hourly request limit is (nearly)
+	// used up, reported by Erply or by the service before calling it.
+	KindQuotaExhausted Kind = "upstream_quota_exhausted"
+	KindConflict       Kind = "conflict"
+	KindInternal       Kind = "internal_error"
+)
+
+// HTTPStatus returns the response status for the kind. Auth errors mean that
+// Erply rejected the service's own credentials or rights, which the client
+// cannot fix, so they are reported as a bad gateway.
+func (k Kind) HTTPStatus() int {
+	switch k {
+	case KindBadRequest:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindValidation:
+		return http.StatusUnprocessableEntity
+	case KindAuth:
+		return http.StatusBadGateway
+	case KindRateLimited:
+		return http.StatusTooManyRequests
+	case KindUnavailable, KindQuotaExhausted:
+		return http.StatusServiceUnavailable
+	case KindConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is a classified error.
+type Error struct {
+	Kind       Kind
+	Message    string
+	Field      string
+	ErplyCode  int
+	Violations []Violation
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration
+	Err        error
+}
+
+// Violation is one failed validation rule of a request. Index is the
+// position of the item in a bulk request, 0 otherwise.
+type Violation struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field" example:"email"`
+	Rule    string `json:"rule" example:"email"`
+	Message string `json:"message" example:"must be a valid email address"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Kind) + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return string(e.Kind) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns the response status for the error.
+func (e *Error) HTTPStatus() int {
+	return e.Kind.HTTPStatus()
+}
+
+// Body is the JSON error body returned to clients.
+type Body struct {
+	Code       Kind        `json:"code" swaggertype:"string" example:"not_found"`
+	Message    string      `json:"message" example:"customer not found"`
+	Field      string      `json:"field,omitempty"`
+	RequestID  string      `json:"requestId,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Body returns the client-facing representation of the error. Upstream error
+// text is never included, only the message set when the error was created.
+func (e *Error) Body(requestID string) Body {
+	return Body{Code: e.Kind, Message: e.Message, Field: e.Field, RequestID: requestID, Violations: e.Violations}
+}
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// BadRequest is used for requests that cannot be parsed at all.
+func BadRequest(message string) *Error {
+	return New(KindBadRequest, message)
+}
+
+func NotFound(message string) *Error {
+	return New(KindNotFound, message)
+}
+
+func Validation(message, field string) *Error {
+	return &Error{Kind: KindValidation, Message: message, Field: field}
+}
+
+// Invalid reports the validation violations of a request.
+func Invalid(violations []Violation) *Error {
+	return &Error{Kind: KindValidation, Message: "request validation failed", Violations: violations}
+}
+
+func Internal(message string, err error) *Error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
+
+// QuotaExhausted reports that the call was not sent to Erply to stay within
+// the hourly request limit.
+func QuotaExhausted(message string, retryAfter time.Duration) *Error {
+	return &Error{Kind: KindQuotaExhausted, Message: message, RetryAfter: retryAfter}
+}
+
+var messages = map[Kind]string{
+	KindNotFound:       "record not found",
+	KindValidation:     "Erply rejected the input",
+	KindAuth:           "Erply rejected the service credentials",
+	KindRateLimited:    "Erply request quota exceeded",
+	KindUnavailable:    "Erply is not available",
+	KindQuotaExhausted: "Erply hourly request limit reached",
+	KindConflict:       "conflicting record in Erply",
+	KindInternal:       "unexpected Erply error",
+}
+
+// KindOf classifies an Erply API error code.
+func KindOf(code sharedCommon.ApiError) Kind {
+	switch code {
+	case sharedCommon.InvalidClassifierID, sharedCommon.NoRecordsFound:
+		return KindNotFound
+	case sharedCommon.RequiredParamMissing, sharedCommon.InconsistentParam, sharedCommon.InvalidFormat,
+		sharedCommon.MalformedRequest, sharedCommon.InvalidValue, sharedCommon.NotUsableField,
+		sharedCommon.IncorrectList, sharedCommon.ArrayValueRequired, sharedCommon.ValueLengthError:
+		return KindValidation
+	case sharedCommon.AccountNotFound, sharedCommon.MissingAuth, sharedCommon.AuthMissing,
+		sharedCommon.LoginFailed, sharedCommon.UserBlocked, sharedCommon.MissingSavedPassword,
+		sharedCommon.APISessionExpired, sharedCommon.InvalidSession, sharedCommon.SessionTooOld,
+		sharedCommon.DemoAccountExpired, sharedCommon.NoUserGroupDetected, sharedCommon.NoViewingRights,
+		sharedCommon.NoAddingRights, sharedCommon.NoEditingRights, sharedCommon.NoDeletingRights,
+		sharedCommon.NoLocationAccess, sharedCommon.NoAPIAccess, sharedCommon.AccountNotConfirmed,
+		sharedCommon.NoAccessToCustomerData:
+		return KindAuth
+	case sharedCommon.HourlyRequestQuota:
+		return KindQuotaExhausted
+	case sharedCommon.SameInstanceIsRunning:
+		return KindRateLimited
+	case sharedCommon.ServerMaintenance, sharedCommon.AccountDbConnError, sharedCommon.ApiNotAvailable,
+		sharedCommon.DbError:
+		return KindUnavailable
+	case sharedCommon.ParamIsNotUnique, sharedCommon.IsAlreadyConfirmed, sharedCommon.MultipleMatchesFound,
+		sharedCommon.RelatedDeletionError, sharedCommon.IdenticalRecordExists,
+		sharedCommon.NotAllowedToChangeValue, sharedCommon.BulkSubRequestDuplicateError:
+		return KindConflict
+	default:
+		return KindInternal
+	}
+}
+
+// FromStatus classifies the status of a single Erply (bulk item) response.
+func FromStatus(status sharedCommon.Status) *Error {
+	kind := KindOf(status.ErrorCode)
+	e := &Error{
+		Kind:      kind,
+		Message:   messages[kind],
+		Field:     status.ErrorField,
+		ErplyCode: int(status.ErrorCode),
+	}
+	if kind == KindQuotaExhausted {
+		e.RetryAfter = UntilQuotaReset(time.Now())
+	}
+	return e
+}
+
+// UntilQuotaReset is how long after t Erply resets the hourly request limit,
+// at the next full hour.
+func UntilQuotaReset(t time.Time) time.Duration {
+	return t.Truncate(time.Hour).Add(time.Hour).Sub(t)
+}
+
+// From classifies an error returned by the Erply client. Errors that are
+// already classified are returned as is. An ErplyError without a code comes
+// from the transport (connection, timeout, unreadable response) and is
+// reported as upstream unavailable.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	var erplyErr *sharedCommon.ErplyError
+	if !errors.As(err, &erplyErr) || erplyErr.Code == 0 {
+		return &Error{Kind: KindUnavailable, Message: messages[KindUnavailable], Err: err}
+	}
+
+	e := FromStatus(sharedCommon.Status{ErrorCode: erplyErr.Code})
+	e.Err = err
+	return e
+}
+
+// FromBulk classifies an error of a bulk call. The wrapper reports a failed
+// item with the code of the whole bulk request, so the item statuses of the
+// response are checked first.
+func FromBulk(err error, statuses ...sharedCommon.StatusBulk) *Error {
+	if err == nil {
+		return nil
+	}
+	for _, status := range statuses {
+		if status.ErrorCode != 0 {
+			e := FromStatus(status.Status)
+			e.Err = err
+			return e
+		}
+	}
+	return From(err)
+}
+
+// Is reports whether err is classified as the given kind.
+func Is(err error, kind Kind) bool {
+	e := From(err)
+	return e != nil && e.Kind == kind
+}
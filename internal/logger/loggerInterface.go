@@ -6,3 +6,8 @@ type LoggerInterface interface {
 	Debug(msg string, keysAndValues ...any)
 	Warn(msg string, keysAndValues ...any)
 }
+
+// Flusher is a logger that buffers output and can write it out.
+type Flusher interface {
+	Flush()
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"log/slog"
+	"os"
 )
 
 type SlogLogger struct {
@@ -29,3 +30,9 @@ func (l *SlogLogger) Debug(msg string, keysAndValues ...any) {
 func (l *SlogLogger) Warn(msg string, keysAndValues ...any) {
 	l.logger.Warn(msg, keysAndValues...)
 }
+
+// Flush syncs stderr, where the default slog handler writes, so nothing is
+// lost when the process exits.
+func (l *SlogLogger) Flush() {
+	_ = os.Stderr.Sync()
+}
@@ -1,24 +1,122 @@
 package middleware
 
 import (
+	"erply_test/internal/auth"
+	"erply_test/internal/logger"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func APIKeyAuthMiddleware(requiredKey string) gin.HandlerFunc {
+const (
+	// PrincipalKey is the gin context key of the authenticated auth.Principal.
+	PrincipalKey = "principal"
+	// PrincipalIDKey holds the principal's ID as a string, for logs and
+	// audit records.
+	PrincipalIDKey = "principalID"
+)
+
+// APIKeyAuthMiddleware authenticates the X-API-KEY header against keys and
+// stores the principal in the gin context.
+func APIKeyAuthMiddleware(keys *auth.KeyStore) gin.HandlerFunc {
+	return AuthMiddleware(keys, nil)
+}
+
+// AuthMiddleware authenticates an "Authorization: Bearer <JWT>" header with
+// tokens or, without one, the X-API-KEY header with keys, and stores the
+// principal in the gin context. tokens may be nil to accept API keys only.
+func AuthMiddleware(keys *auth.KeyStore, tokens *auth.JWTVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok && tokens != nil {
+			principal, err := tokens.Verify(c.Request.Context(), token)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid bearer token"})
+				return
+			}
+			setPrincipal(c, principal)
+			c.Next()
+			return
+		}
+
 		keyFromClient := c.GetHeader("X-API-KEY")
 		if keyFromClient == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key is required"})
+			message := "API key is required"
+			if tokens != nil {
+				message = "API key or bearer token is required"
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
 			return
 		}
 
-		if keyFromClient != requiredKey {
+		principal, err := keys.Authenticate(keyFromClient)
+		if errors.Is(err, auth.ErrUnknownKey) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 			return
 		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
 
+		setPrincipal(c, principal)
 		c.Next()
 	}
 }
+
+func setPrincipal(c *gin.Context, principal auth.Principal) {
+	c.Set(PrincipalKey, principal)
+	c.Set(PrincipalIDKey, principal.ID)
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// GetPrincipal returns the principal stored by the auth middleware.
+func GetPrincipal(c *gin.Context) (auth.Principal, bool) {
+	principal, ok := c.Get(PrincipalKey)
+	if !ok {
+		return auth.Principal{}, false
+	}
+	p, ok := principal.(auth.Principal)
+	return p, ok
+}
+
+// Authorize lets the request through only if the principal has scope and a
+// role that includes role. Denials are logged with the principal.
+func Authorize(logger logger.LoggerInterface, scope string, role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			return
+		}
+
+		var reason string
+		switch {
+		case !principal.HasScope(scope):
+			reason = fmt.Sprintf("%s %s needs scope %s, %s does not have it", c.Request.Method, c.FullPath(), scope, principal.ID)
+		case !principal.Role.Includes(role):
+			have := string(principal.Role)
+			if have == "" {
+				have = "none"
+			}
+			reason = fmt.Sprintf("%s %s needs role %s, %s has role %s", c.Request.Method, c.FullPath(), role, principal.ID, have)
+		default:
+			c.Next()
+			return
+		}
+
+		logger.Warn("Access denied", "principal", principal.ID, "reason", reason, "requestID", c.GetString(RequestIDKey))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "reason": reason})
+	}
+}
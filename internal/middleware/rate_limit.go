@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware limits requests per principal, or per client IP when
+// there is none, and reports the bucket in X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until it is full).
+// Requests over the limit get 429 with Retry-After.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return rateLimit(limiter, func(c *gin.Context) string {
+		if client := c.GetString(PrincipalIDKey); client != "" {
+			return client
+		}
+		return "ip:" + c.ClientIP()
+	})
+}
+
+// IPRateLimitMiddleware limits requests per client IP. It runs before
+// authentication, so it also limits requests with missing or wrong
+// credentials, e.g. guessing API keys.
+func IPRateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return rateLimit(limiter, func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+}
+
+func rateLimit(limiter *ratelimit.Limiter, clientOf func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, limit := limiter.Allow(c.Request.Context(), clientOf(c), c.Request.Method+" "+c.FullPath())
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Count))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("X-RateLimit-Reset", ceilSeconds(res.Reset))
+		if !res.Allowed {
+			c.Header("Retry-After", ceilSeconds(max(res.RetryAfter, time.Second)))
+			e := erplyerr.New(erplyerr.KindRateLimited, "rate limit of "+limit.String()+" exceeded")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, e.Body(c.GetString(RequestIDKey)))
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,137 @@
+// Package quota keeps the service within the hourly request limit of its
+// Erply account, counting calls in Redis so that all replicas share it.
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Counter counts calls per window.
+type Counter interface {
+	// Take counts n calls under key unless that would count more than limit;
+	// a negative limit counts them anyway. The key expires after ttl. It
+	// returns whether the calls were counted and the calls counted so far.
+	Take(ctx context.Context, key string, n, limit int, ttl time.Duration) (bool, int, error)
+	// Count returns the calls counted under key.
+	Count(ctx context.Context, key string) (int, error)
+	// Raise sets the count under key to n unless it is higher already.
+	Raise(ctx context.Context, key string, n int, ttl time.Duration) error
+}
+
+// takeScript checks and increments in one step, so replicas cannot overshoot
+// the limit together.
+var takeScript = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+local cost = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+if limit >= 0 and n + cost > limit then
+	return {0, n}
+end
+n = redis.call('INCRBY', KEYS[1], cost)
+if n == cost then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return {1, n}
+`)
+
+var raiseScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return 0
+`)
+
+// RedisCounter counts in Redis, shared by all replicas.
+type RedisCounter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCounter stores the count of key under prefix+key.
+func NewRedisCounter(client redis.UniversalClient, prefix string) *RedisCounter {
+	return &RedisCounter{client: client, prefix: prefix}
+}
+
+func (r *RedisCounter) Take(ctx context.Context, key string, n, limit int, ttl time.Duration) (bool, int, error) {
+	res, err := takeScript.Run(ctx, r.client, []string{r.prefix + key}, n, limit, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return res[0] == 1, int(res[1]), nil
+}
+
+func (r *RedisCounter) Count(ctx context.Context, key string) (int, error) {
+	n, err := r.client.Get(ctx, r.prefix+key).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (r *RedisCounter) Raise(ctx context.Context, key string, n int, ttl time.Duration) error {
+	return raiseScript.Run(ctx, r.client, []string{r.prefix + key}, n, ttl.Milliseconds()).Err()
+}
+
+// MemoryCounter counts in process. Each replica then counts on its own.
+type MemoryCounter struct {
+	mu     sync.Mutex
+	counts map[string]*count
+}
+
+type count struct {
+	n       int
+	expires time.Time
+}
+
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{counts: map[string]*count{}}
+}
+
+func (m *MemoryCounter) Take(ctx context.Context, key string, n, limit int, ttl time.Duration) (bool, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.get(key, ttl)
+	if limit >= 0 && c.n+n > limit {
+		return false, c.n, nil
+	}
+	c.n += n
+	return true, c.n, nil
+}
+
+func (m *MemoryCounter) Raise(ctx context.Context, key string, n int, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.get(key, ttl)
+	c.n = max(c.n, n)
+	return nil
+}
+
+// get returns the count of key, dropping the expired ones first.
+func (m *MemoryCounter) get(key string, ttl time.Duration) *count {
+	now := time.Now()
+	for k, c := range m.counts {
+		if now.After(c.expires) {
+			delete(m.counts, k)
+		}
+	}
+	c, ok := m.counts[key]
+	if !ok {
+		c = &count{expires: now.Add(ttl)}
+		m.counts[key] = c
+	}
+	return c
+}
+
+func (m *MemoryCounter) Count(ctx context.Context, key string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.counts[key]; ok && time.Now().Before(c.expires) {
+		return c.n, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,198 @@
+package quota
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/logger"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config is the hourly quota of an Erply account.
+type Config struct {
+	// Limit is the requests per hour Erply allows the account.
+	Limit int
+	// Reserve is the part of the quota that is paced: once fewer calls are
+	// left, they are spread over the rest of the hour, and callers wait up
+	// to MaxWait for their turn instead of using it up at once.
+	Reserve int
+	MaxWait time.Duration
+}
+
+// Status is the quota of the current hour.
+type Status struct {
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+	// Queued and Rejected count the calls this instance delayed and refused
+	// since it started.
+	Queued   int64 `json:"queued"`
+	Rejected int64 `json:"rejected"`
+	// Shared is false while the counter fails and calls are counted per
+	// instance.
+	Shared bool `json:"shared"`
+}
+
+// Governor counts the Erply calls of an account per clock hour, which is how
+// Erply resets its limit. While the counter fails, e.g. Redis is down, it
+// counts in process.
+type Governor struct {
+	counter  Counter
+	fallback *MemoryCounter
+	account  string
+	config   Config
+	logger   logger.LoggerInterface
+	degraded atomic.Bool
+	queued   atomic.Int64
+	rejected atomic.Int64
+
+	mu sync.Mutex
+	// next is when this instance may send its next paced call.
+	next time.Time
+	// window and used are the count seen by the last call.
+	window string
+	used   int
+}
+
+func NewGovernor(counter Counter, account string, config Config, logger logger.LoggerInterface) *Governor {
+	return &Governor{counter: counter, fallback: NewMemoryCounter(), account: account, config: config, logger: logger}
+}
+
+// Acquire counts a call that costs cost requests, e.g. a bulk call with that
+// many sub-requests, before it is sent to Erply. Within the reserve it waits
+// for the call's turn. It returns an erplyerr.KindQuotaExhausted error with a
+// RetryAfter when the quota is used up or the turn is too far away.
+func (g *Governor) Acquire(ctx context.Context, cost int) error {
+	cost = max(cost, 1)
+	now := time.Now()
+	window, reset := hour(now)
+	if remaining := g.remaining(window); remaining <= g.config.Reserve {
+		interval := reset.Sub(now) / time.Duration(max(remaining, 1)) * time.Duration(cost)
+		if err := g.wait(ctx, now, interval); err != nil {
+			return err
+		}
+	}
+
+	window, reset = hour(time.Now())
+	if !g.take(ctx, window, cost, g.config.Limit, time.Until(reset)) {
+		g.rejected.Add(1)
+		return erplyerr.QuotaExhausted(fmt.Sprintf("Erply hourly request limit of %d reached", g.config.Limit), time.Until(reset))
+	}
+	return nil
+}
+
+// Record counts a call that is sent anyway, such as the session check.
+func (g *Governor) Record(ctx context.Context) {
+	window, reset := hour(time.Now())
+	g.take(ctx, window, 1, -1, time.Until(reset))
+}
+
+// MarkExhausted records that Erply refused a call for the hourly limit, e.g.
+// because other users of the account used it up, so no more calls are sent
+// until the hour ends.
+func (g *Governor) MarkExhausted(ctx context.Context) {
+	window, reset := hour(time.Now())
+	key := g.account + ":" + window
+	ttl := time.Until(reset) + time.Minute
+	if err := g.counter.Raise(ctx, key, g.config.Limit, ttl); err != nil {
+		g.logger.Warn("Error marking Erply quota exhausted", "error", err)
+	}
+	g.fallback.Raise(ctx, key, g.config.Limit, ttl)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.window != window || g.used < g.config.Limit {
+		g.logger.Warn("Erply reports the hourly request limit reached", "resetAt", reset)
+	}
+	g.window, g.used = window, max(g.used, g.config.Limit)
+}
+
+// wait reserves the next paced turn, interval after the previous one, and
+// waits for it.
+func (g *Governor) wait(ctx context.Context, now time.Time, interval time.Duration) error {
+	g.mu.Lock()
+	at := now
+	if g.next.After(at) {
+		at = g.next
+	}
+	delay := at.Sub(now)
+	if delay > g.config.MaxWait {
+		g.mu.Unlock()
+		g.rejected.Add(1)
+		return erplyerr.QuotaExhausted("Erply hourly request limit nearly reached, calls are paced", delay)
+	}
+	g.next = at.Add(interval)
+	g.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	g.queued.Add(1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *Governor) take(ctx context.Context, window string, n, limit int, ttl time.Duration) bool {
+	key := g.account + ":" + window
+	// Counts outlive their hour a little, so one never expires mid-hour.
+	ttl += time.Minute
+	taken, used, err := g.counter.Take(ctx, key, n, limit, ttl)
+	if err != nil {
+		if !g.degraded.Swap(true) {
+			g.logger.Warn("Erply quota counter failing, counting per instance", "error", err)
+		}
+		taken, used, _ = g.fallback.Take(ctx, key, n, limit, ttl)
+	} else if g.degraded.Swap(false) {
+		g.logger.Info("Erply quota counter recovered")
+	}
+
+	g.mu.Lock()
+	g.window, g.used = window, used
+	g.mu.Unlock()
+	return taken
+}
+
+// remaining is the quota left as of the last call, or all of it in a new
+// hour.
+func (g *Governor) remaining(window string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.window != window {
+		return g.config.Limit
+	}
+	return g.config.Limit - g.used
+}
+
+// Status reads the count of the current hour.
+func (g *Governor) Status(ctx context.Context) Status {
+	window, reset := hour(time.Now())
+	key := g.account + ":" + window
+	used, err := g.counter.Count(ctx, key)
+	if err != nil || g.degraded.Load() {
+		used, _ = g.fallback.Count(ctx, key)
+	}
+	return Status{
+		Limit:     g.config.Limit,
+		Used:      used,
+		Remaining: max(g.config.Limit-used, 0),
+		ResetAt:   reset,
+		Queued:    g.queued.Load(),
+		Rejected:  g.rejected.Load(),
+		Shared:    err == nil && !g.degraded.Load(),
+	}
+}
+
+// hour returns the UTC clock hour of t, as a key, and when it ends.
+func hour(t time.Time) (string, time.Time) {
+	start := t.UTC().Truncate(time.Hour)
+	return start.Format("2006010215"), start.Add(time.Hour)
+}
@@ -0,0 +1,80 @@
+// Package ratelimit limits how often each client may call a route, with
+// token buckets kept in Redis so that all replicas share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Count requests per Per. A client that was idle may burst up to
+// Count requests at once; after that tokens come back at Count/Per.
+type Limit struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseLimit reads "<count>/<s|m|h>", e.g. "30/m".
+func ParseLimit(s string) (Limit, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected e.g. 30/m", s)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit unit in %q, expected s, m or h", s)
+	}
+	return Limit{Count: n, Per: per}, nil
+}
+
+func (l Limit) String() string {
+	unit := map[time.Duration]string{time.Second: "s", time.Minute: "m", time.Hour: "h"}[l.Per]
+	if unit == "" {
+		return fmt.Sprintf("%d/%s", l.Count, l.Per)
+	}
+	return fmt.Sprintf("%d/%s", l.Count, unit)
+}
+
+// perSecond is the refill rate.
+func (l Limit) perSecond() float64 {
+	return float64(l.Count) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token, when not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// result builds a Result from the tokens left in a bucket.
+func result(allowed bool, tokens float64, limit Limit) Result {
+	rate := limit.perSecond()
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Count) - tokens) / rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
+
+// Store keeps token buckets.
+type Store interface {
+	// Take takes one token from the bucket key, which holds limit.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"erply_test/internal/logger"
+	"sync/atomic"
+)
+
+// Limits are the limits of each client: Routes by "METHOD /path" as
+// registered in gin, e.g. "POST /api/customers/save", and Default for the
+// other routes together.
+type Limits struct {
+	Default Limit
+	Routes  map[string]Limit
+}
+
+// Limiter applies Limits per client. While its store fails, e.g. Redis is
+// down, it falls back to buckets in process.
+type Limiter struct {
+	store    Store
+	fallback *MemoryStore
+	limits   Limits
+	logger   logger.LoggerInterface
+	degraded atomic.Bool
+}
+
+func NewLimiter(store Store, limits Limits, logger logger.LoggerInterface) *Limiter {
+	return &Limiter{store: store, fallback: NewMemoryStore(), limits: limits, logger: logger}
+}
+
+// Allow takes a token for client calling route and returns the result and
+// the limit that applied.
+func (l *Limiter) Allow(ctx context.Context, client, route string) (Result, Limit) {
+	limit, ok := l.limits.Routes[route]
+	key := client + "|" + route
+	if !ok {
+		limit, key = l.limits.Default, client+"|*"
+	}
+
+	res, err := l.store.Take(ctx, key, limit)
+	if err != nil {
+		if !l.degraded.Swap(true) {
+			l.logger.Warn("Rate limit store failing, limiting per instance", "error", err)
+		}
+		res, _ = l.fallback.Take(ctx, key, limit)
+		return res, limit
+	}
+	if l.degraded.Swap(false) {
+		l.logger.Info("Rate limit store recovered")
+	}
+	return res, limit
+}
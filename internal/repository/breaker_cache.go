@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"context"
+	"erply_test/internal/logger"
+	"sync"
+	"time"
+)
+
+// Pinger is a cache whose backend can be health-checked.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingableCache is a cache that BreakerCache can probe.
+type PingableCache interface {
+	CacheInterface
+	Pinger
+}
+
+// HealthReporter reports whether a cache is usable.
+type HealthReporter interface {
+	Healthy() bool
+}
+
+const (
+	breakerPingTimeout = 2 * time.Second
+	// breakerMaxPending bounds the invalidations kept for replay while the
+	// breaker is open.
+	breakerMaxPending = 10000
+)
+
+// BreakerCache makes a remote cache a soft dependency. After threshold
+// consecutive errors the breaker opens: reads miss, writes are dropped and
+// locks are always granted, so requests go straight to Erply. While open, the
+// backend is pinged every cooldown; on success the breaker closes again.
+//
+// Deletes and tag invalidations that were skipped or failed are replayed
+// before closing, so entries written before the outage do not come back
+// stale. If more than breakerMaxPending pile up, the rest are lost and those
+// entries may be stale until they expire.
+type BreakerCache struct {
+	inner     PingableCache
+	logger    logger.LoggerInterface
+	threshold int
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	open        bool
+	failures    int
+	pendingKeys map[string]struct{}
+	pendingTags map[string]struct{}
+	overflowed  bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBreakerCache wraps inner. It pings inner once and starts open, in
+// degraded mode, when that fails.
+func NewBreakerCache(inner PingableCache, logger logger.LoggerInterface, threshold int, cooldown time.Duration) *BreakerCache {
+	b := &BreakerCache{
+		inner:       inner,
+		logger:      logger,
+		threshold:   max(threshold, 1),
+		cooldown:    cooldown,
+		pendingKeys: map[string]struct{}{},
+		pendingTags: map[string]struct{}{},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), breakerPingTimeout)
+	defer cancel()
+	if err := inner.Ping(ctx); err != nil {
+		b.open = true
+		logger.Warn("Cache unavailable, starting in degraded mode", "error", err)
+	}
+	go b.probe()
+	return b
+}
+
+// Healthy reports whether the breaker is closed.
+func (b *BreakerCache) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open
+}
+
+// Ping checks the backend directly, whatever the breaker state.
+func (b *BreakerCache) Ping(ctx context.Context) error {
+	return b.inner.Ping(ctx)
+}
+
+func (b *BreakerCache) Get(ctx context.Context, key string) (string, error) {
+	if !b.Healthy() {
+		return "", nil
+	}
+	val, err := b.inner.Get(ctx, key)
+	return val, b.result(ctx, err)
+}
+
+func (b *BreakerCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if !b.Healthy() {
+		return nil
+	}
+	return b.result(ctx, b.inner.Set(ctx, key, value, expiration))
+}
+
+func (b *BreakerCache) SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error {
+	if !b.Healthy() {
+		return nil
+	}
+	return b.result(ctx, b.inner.SetWithTags(ctx, key, value, expiration, tags...))
+}
+
+func (b *BreakerCache) Delete(ctx context.Context, keys ...string) error {
+	if !b.Healthy() {
+		b.keepPending(keys, nil)
+		return nil
+	}
+	err := b.result(ctx, b.inner.Delete(ctx, keys...))
+	if err != nil {
+		b.keepPending(keys, nil)
+	}
+	return err
+}
+
+func (b *BreakerCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if !b.Healthy() {
+		b.keepPending(nil, tags)
+		return nil
+	}
+	err := b.result(ctx, b.inner.InvalidateTags(ctx, tags...))
+	if err != nil {
+		b.keepPending(nil, tags)
+	}
+	return err
+}
+
+// TryLock grants every lock while the breaker is open: there is no shared
+// store to coordinate through, and waiting would only delay the fetch.
+func (b *BreakerCache) TryLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	if !b.Healthy() {
+		return true, nil
+	}
+	ok, err := b.inner.TryLock(ctx, key, token, ttl)
+	return ok, b.result(ctx, err)
+}
+
+func (b *BreakerCache) Unlock(ctx context.Context, key string, token string) error {
+	if !b.Healthy() {
+		return nil
+	}
+	return b.result(ctx, b.inner.Unlock(ctx, key, token))
+}
+
+func (b *BreakerCache) Close() error {
+	b.closeOnce.Do(func() { close(b.stop) })
+	<-b.done
+	return b.inner.Close()
+}
+
+// result counts err towards opening the breaker and passes it on. Errors
+// caused by the caller giving up do not count.
+func (b *BreakerCache) result(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return nil
+	}
+	b.failures++
+	if !b.open && b.failures >= b.threshold {
+		b.open = true
+		b.logger.Warn("Cache failing, bypassing it", "failures", b.failures, "error", err)
+	}
+	return err
+}
+
+// keepPending keeps keys and tags to delete once the cache is back.
+func (b *BreakerCache) keepPending(keys, tags []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	add := func(set map[string]struct{}, items []string) {
+		for _, item := range items {
+			if len(b.pendingKeys)+len(b.pendingTags) >= breakerMaxPending {
+				b.overflowed = true
+				return
+			}
+			set[item] = struct{}{}
+		}
+	}
+	add(b.pendingKeys, keys)
+	add(b.pendingTags, tags)
+}
+
+// probe pings the backend every cooldown while the breaker is open and
+// closes it once the backend answers and the pending invalidations are
+// replayed.
+func (b *BreakerCache) probe() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.cooldown)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+		b.mu.Lock()
+		open, pending := b.open, len(b.pendingKeys)+len(b.pendingTags)
+		b.mu.Unlock()
+		if !open && pending == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), breakerPingTimeout)
+		err := b.inner.Ping(ctx)
+		if err == nil {
+			err = b.replay(ctx)
+		}
+		cancel()
+		if err != nil {
+			if !open {
+				b.logger.Warn("Error replaying cache invalidations", "error", err)
+			}
+			continue
+		}
+
+		b.mu.Lock()
+		b.open = false
+		b.failures = 0
+		b.mu.Unlock()
+		if open {
+			b.logger.Info("Cache recovered")
+		}
+	}
+}
+
+// replay runs the deferred deletes and tag invalidations. What fails stays
+// pending.
+func (b *BreakerCache) replay(ctx context.Context) error {
+	b.mu.Lock()
+	keys := setKeys(b.pendingKeys)
+	tags := setKeys(b.pendingTags)
+	overflowed := b.overflowed
+	b.pendingKeys = map[string]struct{}{}
+	b.pendingTags = map[string]struct{}{}
+	b.overflowed = false
+	b.mu.Unlock()
+
+	var err error
+	if len(keys) > 0 {
+		if err = b.inner.Delete(ctx, keys...); err != nil {
+			b.keepPending(keys, nil)
+		}
+	}
+	if len(tags) > 0 {
+		if tagErr := b.inner.InvalidateTags(ctx, tags...); tagErr != nil {
+			b.keepPending(nil, tags)
+			err = tagErr
+		}
+	}
+	if overflowed {
+		b.logger.Warn("Too many cache invalidations while the cache was down; some entries may be stale until they expire")
+	}
+	return err
+}
+
+func setKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
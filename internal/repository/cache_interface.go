@@ -8,6 +8,16 @@ import (
 type CacheInterface interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value string, expiration time.Duration) error
+	// SetWithTags stores value like Set and records key under every tag, so
+	// it can be dropped with InvalidateTags.
+	SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error
 	Delete(ctx context.Context, keys ...string) error
+	// InvalidateTags deletes every key recorded under any of the tags.
+	InvalidateTags(ctx context.Context, tags ...string) error
+	// TryLock takes the lock key for ttl unless someone else holds it. token
+	// identifies the holder for Unlock.
+	TryLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+	// Unlock releases the lock key if it is still held with token.
+	Unlock(ctx context.Context, key string, token string) error
 	Close() error
 }
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms accepted by NewCodec.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// ErrCorrupt is returned for cached values that cannot be decoded.
+var ErrCorrupt = errors.New("corrupt cache value")
+
+// compression flags in the envelope
+const (
+	flagNone = 'n'
+	flagGzip = 'g'
+	flagZstd = 'z'
+)
+
+// Codec turns values into cache strings and back. A value is stored as JSON
+// behind a "v<schema version>:<compression flag>:" header, so values written
+// for another version of a struct can be recognized and values written with
+// another compression setting can still be read. Values shorter than
+// minSize are stored uncompressed.
+type Codec struct {
+	flag    byte
+	minSize int
+	zenc    *zstd.Encoder
+	zdec    *zstd.Decoder
+}
+
+func NewCodec(compression string, minSize int) (*Codec, error) {
+	c := &Codec{minSize: minSize}
+	switch compression {
+	case CompressionNone, "":
+		c.flag = flagNone
+	case CompressionGzip:
+		c.flag = flagGzip
+	case CompressionZstd:
+		c.flag = flagZstd
+	default:
+		return nil, fmt.Errorf("unknown compression %q, expected none, gzip or zstd", compression)
+	}
+
+	var err error
+	if c.zenc, err = zstd.NewWriter(nil); err != nil {
+		return nil, err
+	}
+	if c.zdec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Encode returns v as a cache string tagged with version.
+func (c *Codec) Encode(v any, version int) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	flag := c.flag
+	if len(data) < c.minSize {
+		flag = flagNone
+	}
+	switch flag {
+	case flagGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	case flagZstd:
+		data = c.zenc.EncodeAll(data, nil)
+	}
+	return "v" + strconv.Itoa(version) + ":" + string(flag) + ":" + string(data), nil
+}
+
+// Decode reads s into v. It returns false, and leaves v alone, when s was
+// written with a schema version other than version. Values that cannot be
+// decoded give an error wrapping ErrCorrupt.
+func (c *Codec) Decode(s string, version int, v any) (bool, error) {
+	rest, ok := strings.CutPrefix(s, "v")
+	if !ok {
+		return false, ErrCorrupt
+	}
+	ver, rest, ok := strings.Cut(rest, ":")
+	if !ok || len(rest) < 2 || rest[1] != ':' {
+		return false, ErrCorrupt
+	}
+	if n, err := strconv.Atoi(ver); err != nil {
+		return false, ErrCorrupt
+	} else if n != version {
+		return false, nil
+	}
+
+	data := []byte(rest[2:])
+	var err error
+	switch rest[0] {
+	case flagNone:
+	case flagGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = io.ReadAll(r)
+		}
+	case flagZstd:
+		data, err = c.zdec.DecodeAll(data, nil)
+	default:
+		err = fmt.Errorf("unknown compression flag %q", rest[0])
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process LRU cache with TTL support. Once it holds
+// maxEntries keys, the least recently used key is evicted. Expired keys are
+// dropped on access and by a background sweep.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	// lru holds *memoryEntry values, most recently used first.
+	lru   *list.List
+	items map[string]*list.Element
+	tags  map[string]map[string]struct{}
+	locks map[string]memoryLock
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time // zero means no expiry
+	tags      []string
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+type memoryLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewMemoryCache returns a cache holding at most maxEntries keys that drops
+// expired keys every sweepInterval. Close stops the sweep.
+func NewMemoryCache(maxEntries int, sweepInterval time.Duration) *MemoryCache {
+	c := &MemoryCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		items:      map[string]*list.Element{},
+		tags:       map[string]map[string]struct{}{},
+		locks:      map[string]memoryLock{},
+		stop:       make(chan struct{}),
+	}
+	go c.sweep(sweepInterval)
+	return c
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return "", nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if entry.expired(time.Now()) {
+		c.remove(el)
+		return "", nil
+	}
+	c.lru.MoveToFront(el)
+	return entry.value, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return c.SetWithTags(ctx, key, value, expiration)
+}
+
+func (c *MemoryCache) SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if expiration > 0 {
+		expiresAt = time.Now().Add(expiration)
+	}
+
+	el, ok := c.items[key]
+	if ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(el)
+	} else {
+		el = c.lru.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+		c.items[key] = el
+	}
+
+	// Like the Redis tag sets, a key stays under the tags of earlier writes.
+	entry := el.Value.(*memoryEntry)
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			c.tags[tag] = keys
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = struct{}{}
+			entry.tags = append(entry.tags, tag)
+		}
+	}
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	_, err := c.DropTags(ctx, tags...)
+	return err
+}
+
+// DropTags deletes every key recorded under any of the tags and returns the
+// deleted keys.
+func (c *MemoryCache) DropTags(ctx context.Context, tags ...string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var dropped []string
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if el, ok := c.items[key]; ok {
+				c.remove(el)
+				dropped = append(dropped, key)
+			}
+		}
+		delete(c.tags, tag)
+	}
+	return dropped, nil
+}
+
+// TryLock takes a lock that is kept apart from the cached keys, so it is
+// never evicted.
+func (c *MemoryCache) TryLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if lock, ok := c.locks[key]; ok && now.Before(lock.expiresAt) {
+		return false, nil
+	}
+	c.locks[key] = memoryLock{token: token, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (c *MemoryCache) Unlock(ctx context.Context, key string, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if lock, ok := c.locks[key]; ok && lock.token == token {
+		delete(c.locks, key)
+	}
+	return nil
+}
+
+// Clear drops all keys.
+func (c *MemoryCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.items = map[string]*list.Element{}
+	c.tags = map[string]map[string]struct{}{}
+}
+
+// Len returns the number of keys held, including expired keys that were not
+// swept yet.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *MemoryCache) Close() error {
+	c.closeOnce.Do(func() { close(c.stop) })
+	return nil
+}
+
+// remove drops an entry and its tag memberships. c.mu must be held.
+func (c *MemoryCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*memoryEntry)
+	delete(c.items, entry.key)
+	for _, tag := range entry.tags {
+		keys := c.tags[tag]
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+func (c *MemoryCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for el := c.lru.Front(); el != nil; {
+				next := el.Next()
+				if el.Value.(*memoryEntry).expired(now) {
+					c.remove(el)
+				}
+				el = next
+			}
+			for key, lock := range c.locks {
+				if !now.Before(lock.expiresAt) {
+					delete(c.locks, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// NoopCache stores nothing; every Get is a miss. It is used to run without a
+// cache.
+type NoopCache struct{}
+
+func NewNoopCache() *NoopCache {
+	return &NoopCache{}
+}
+
+func (NoopCache) Get(ctx context.Context, key string) (string, error) {
+	return "", nil
+}
+
+func (NoopCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return nil
+}
+
+func (NoopCache) SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error {
+	return nil
+}
+
+func (NoopCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
+
+func (NoopCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return nil
+}
+
+// TryLock always succeeds: without a shared store there is nobody to
+// coordinate with.
+func (NoopCache) TryLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (NoopCache) Unlock(ctx context.Context, key string, token string) error {
+	return nil
+}
+
+func (NoopCache) Close() error {
+	return nil
+}
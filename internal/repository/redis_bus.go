@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisInvalidationBus broadcasts evicted keys over a Redis pub/sub channel.
+type RedisInvalidationBus struct {
+	client  redis.UniversalClient
+	channel string
+	// origin identifies this instance, so it skips its own messages.
+	origin string
+}
+
+type invalidationMessage struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+func NewRedisInvalidationBus(client redis.UniversalClient, channel string) *RedisInvalidationBus {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &RedisInvalidationBus{
+		client:  client,
+		channel: channel,
+		origin:  hex.EncodeToString(b),
+	}
+}
+
+func (b *RedisInvalidationBus) Publish(ctx context.Context, keys []string) error {
+	payload, err := json.Marshal(invalidationMessage{Origin: b.origin, Keys: keys})
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+// Subscribe listens until ctx is done. go-redis resubscribes after a
+// connection loss; messages sent meanwhile are lost, so every (re)subscribe
+// calls reset.
+func (b *RedisInvalidationBus) Subscribe(ctx context.Context, evict func(keys []string), reset func()) {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+
+	ch := pubsub.ChannelWithSubscriptions()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind == "subscribe" {
+					reset()
+				}
+			case *redis.Message:
+				var inv invalidationMessage
+				if err := json.Unmarshal([]byte(m.Payload), &inv); err != nil || inv.Origin == b.origin {
+					continue
+				}
+				evict(inv.Keys)
+			}
+		}
+	}
+}
@@ -7,13 +7,20 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// RedisCache stores keys in Redis. It works with a single server, Sentinel
+// and Cluster clients.
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
+	// cluster is set for cluster clients, which cannot run transactions or
+	// multi-key commands across hash slots.
+	cluster bool
 }
 
-func NewRedisCache(client *redis.Client) *RedisCache {
+func NewRedisCache(client redis.UniversalClient) *RedisCache {
+	_, cluster := client.(*redis.ClusterClient)
 	return &RedisCache{
-		client: client,
+		client:  client,
+		cluster: cluster,
 	}
 }
 
@@ -32,10 +39,103 @@ func (r *RedisCache) Set(ctx context.Context, key string, value string, expirati
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetWithTags stores the key and adds it to a set per tag. The tag sets
+// expire together with their newest key. The writes are a transaction except
+// in cluster mode, where the key and its tag sets live in different slots.
+func (r *RedisCache) SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error {
+	pipelined := r.client.TxPipelined
+	if r.cluster {
+		pipelined = r.client.Pipelined
+	}
+	_, err := pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, expiration)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKey(tag), key)
+			if expiration > 0 {
+				pipe.Expire(ctx, tagKey(tag), expiration)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *RedisCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	_, err := r.DropTags(ctx, tags...)
+	return err
+}
+
+// DropTags deletes every key recorded under any of the tags and returns the
+// deleted keys.
+func (r *RedisCache) DropTags(ctx context.Context, tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	cmds := make([]*redis.StringSliceCmd, 0, len(tags))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			cmds = append(cmds, pipe.SMembers(ctx, tagKey(tag)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			pipe.Del(ctx, tagKey(tag))
+			for _, key := range cmds[i].Val() {
+				pipe.Del(ctx, key)
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
 func (r *RedisCache) Delete(ctx context.Context, keys ...string) error {
-	return r.client.Del(ctx, keys...).Err()
+	if !r.cluster {
+		return r.client.Del(ctx, keys...).Err()
+	}
+	// One DEL per key, so the cluster client can route each to its slot.
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// unlockScript deletes the lock only when it still holds the caller's token,
+// so a lock that expired and was taken by someone else is left alone.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (r *RedisCache) TryLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, token, ttl).Result()
+}
+
+func (r *RedisCache) Unlock(ctx context.Context, key string, token string) error {
+	return unlockScript.Run(ctx, r.client, []string{key}, token).Err()
+}
+
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
 }
 
+// Close does nothing: the client is shared and closed by its owner.
 func (r *RedisCache) Close() error {
-	return r.client.Close()
+	return nil
+}
+
+func tagKey(tag string) string {
+	return "tag:" + tag
 }
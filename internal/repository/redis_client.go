@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis connection modes accepted by NewRedisClient.
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+// RedisConfig describes how to reach Redis. Zero values keep the go-redis
+// defaults. The env tags are read with the REDIS_ prefix by app.Config.
+type RedisConfig struct {
+	// Mode is single, sentinel or cluster.
+	Mode string `env:"MODE" envDefault:"single"`
+	// URL is a redis:// or rediss:// URL. Its address, credentials, DB and
+	// TLS setting are used unless set below.
+	URL string `env:"URL"`
+	// Addrs is the server address in single mode, the sentinel addresses in
+	// sentinel mode and the seed nodes in cluster mode.
+	Addrs []string `env:"ADDR" envSeparator:","`
+
+	Username string `env:"USERNAME"`
+	Password string `env:"PASSWORD"`
+	DB       int    `env:"DB"`
+	// MasterName and SentinelPassword are used in sentinel mode.
+	MasterName       string `env:"MASTER_NAME"`
+	SentinelPassword string `env:"SENTINEL_PASSWORD"`
+
+	// TLS is implied by a rediss:// URL or any of the TLS files.
+	TLS         bool   `env:"TLS"`
+	TLSCAFile   string `env:"TLS_CA"`
+	TLSCertFile string `env:"TLS_CERT"`
+	TLSKeyFile  string `env:"TLS_KEY"`
+
+	PoolSize     int           `env:"POOL_SIZE"`
+	DialTimeout  time.Duration `env:"DIAL_TIMEOUT"`
+	ReadTimeout  time.Duration `env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `env:"WRITE_TIMEOUT"`
+}
+
+// NewRedisClient creates the client for cfg.Mode. It does not connect.
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	opts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Mode {
+	case RedisModeSingle, "":
+		if len(opts.Addrs) > 1 {
+			return nil, errors.New("redis single mode takes one address")
+		}
+		return redis.NewClient(opts.Simple()), nil
+	case RedisModeSentinel:
+		if opts.MasterName == "" {
+			return nil, errors.New("redis sentinel mode needs a master name")
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case RedisModeCluster:
+		if opts.DB != 0 {
+			return nil, errors.New("redis cluster mode has no DB index")
+		}
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q, expected single, sentinel or cluster", cfg.Mode)
+	}
+}
+
+func (cfg RedisConfig) options() (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		MasterName:       cfg.MasterName,
+		SentinelPassword: cfg.SentinelPassword,
+		PoolSize:         cfg.PoolSize,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+	}
+
+	useTLS := cfg.TLS || cfg.TLSCAFile != "" || cfg.TLSCertFile != ""
+	if cfg.URL != "" {
+		parsed, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		if len(opts.Addrs) == 0 {
+			opts.Addrs = []string{parsed.Addr}
+		}
+		if opts.Username == "" {
+			opts.Username = parsed.Username
+		}
+		if opts.Password == "" {
+			opts.Password = parsed.Password
+		}
+		if opts.DB == 0 {
+			opts.DB = parsed.DB
+		}
+		useTLS = useTLS || parsed.TLSConfig != nil
+	}
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("no redis address configured")
+	}
+
+	if useTLS {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+// tlsConfig trusts TLSCAFile in addition to the system roots and presents
+// the client certificate when one is set. The server name is taken from the
+// address of each connection.
+func (cfg RedisConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading redis CA: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in redis CA file %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// TaggedCache is a cache whose tag invalidation reports the keys it dropped.
+type TaggedCache interface {
+	CacheInterface
+	DropTags(ctx context.Context, tags ...string) ([]string, error)
+}
+
+// InvalidationBus broadcasts keys evicted on one instance to the others.
+type InvalidationBus interface {
+	// Publish sends keys evicted by this instance to the other instances.
+	Publish(ctx context.Context, keys []string) error
+	// Subscribe calls evict with the keys published by other instances and
+	// reset when messages may have been missed. It returns when ctx is done.
+	Subscribe(ctx context.Context, evict func(keys []string), reset func())
+}
+
+// TieredCache keeps a small in-process L1 in front of a shared L2. Every
+// write and eviction is published on the bus, so the other instances drop
+// their L1 copy. Messages can be lost while the bus reconnects, so L1
+// entries live at most l1TTL.
+type TieredCache struct {
+	l1    *MemoryCache
+	l2    TaggedCache
+	bus   InvalidationBus
+	l1TTL time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewTieredCache(l1 *MemoryCache, l2 TaggedCache, bus InvalidationBus, l1TTL time.Duration) *TieredCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TieredCache{
+		l1:     l1,
+		l2:     l2,
+		bus:    bus,
+		l1TTL:  l1TTL,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		bus.Subscribe(ctx, func(keys []string) {
+			_ = l1.Delete(ctx, keys...)
+		}, l1.Clear)
+	}()
+	return c
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) (string, error) {
+	if val, _ := c.l1.Get(ctx, key); val != "" {
+		return val, nil
+	}
+	val, err := c.l2.Get(ctx, key)
+	if err != nil || val == "" {
+		return val, err
+	}
+	_ = c.l1.Set(ctx, key, val, c.l1TTL)
+	return val, nil
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return c.SetWithTags(ctx, key, value, expiration)
+}
+
+func (c *TieredCache) SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error {
+	if err := c.l2.SetWithTags(ctx, key, value, expiration, tags...); err != nil {
+		return err
+	}
+	_ = c.l1.Set(ctx, key, value, c.localTTL(expiration))
+	return c.bus.Publish(ctx, []string{key})
+}
+
+func (c *TieredCache) Delete(ctx context.Context, keys ...string) error {
+	_ = c.l1.Delete(ctx, keys...)
+	if err := c.l2.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	return c.bus.Publish(ctx, keys)
+}
+
+// InvalidateTags resolves the tags to keys in L2, so the other instances only
+// have to drop keys.
+func (c *TieredCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	keys, err := c.l2.DropTags(ctx, tags...)
+	_ = c.l1.Delete(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.bus.Publish(ctx, keys)
+}
+
+// TryLock locks in L2, so the lock is shared by all instances.
+func (c *TieredCache) TryLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return c.l2.TryLock(ctx, key, token, ttl)
+}
+
+func (c *TieredCache) Unlock(ctx context.Context, key string, token string) error {
+	return c.l2.Unlock(ctx, key, token)
+}
+
+// Ping checks L2 when it can be checked.
+func (c *TieredCache) Ping(ctx context.Context) error {
+	if p, ok := c.l2.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *TieredCache) Close() error {
+	c.cancel()
+	<-c.done
+	_ = c.l1.Close()
+	return c.l2.Close()
+}
+
+// localTTL caps the TTL of an L1 entry at l1TTL.
+func (c *TieredCache) localTTL(expiration time.Duration) time.Duration {
+	if expiration > 0 && expiration < c.l1TTL {
+		return expiration
+	}
+	return c.l1TTL
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Typed stores values of type T in a cache through a Codec. Values written
+// with another schema version read as misses, so bumping the version after
+// T changes shape drops the old entries.
+type Typed[T any] struct {
+	cache   CacheInterface
+	codec   *Codec
+	version int
+}
+
+func NewTyped[T any](cache CacheInterface, codec *Codec, version int) *Typed[T] {
+	return &Typed[T]{cache: cache, codec: codec, version: version}
+}
+
+// Get returns the value under key and whether there was one of the current
+// schema version. A value that cannot be decoded gives an error wrapping
+// ErrCorrupt.
+func (t *Typed[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var val T
+	raw, err := t.cache.Get(ctx, key)
+	if err != nil || raw == "" {
+		return val, false, err
+	}
+	ok, err := t.codec.Decode(raw, t.version, &val)
+	return val, ok, err
+}
+
+// Set stores val under key, tagged with tags when there are any.
+func (t *Typed[T]) Set(ctx context.Context, key string, val T, expiration time.Duration, tags ...string) error {
+	raw, err := t.codec.Encode(val, t.version)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return t.cache.Set(ctx, key, raw, expiration)
+	}
+	return t.cache.SetWithTags(ctx, key, raw, expiration, tags...)
+}
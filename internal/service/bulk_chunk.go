@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"sync"
+	"time"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+)
+
+const (
+	// bulkChunkSize is the most sub-requests Erply accepts in one bulk call.
+	bulkChunkSize = sharedCommon.MaxBulkRequestsCount
+	// bulkConcurrency is how many chunks are sent to Erply at the same time.
+	bulkConcurrency = 4
+	// maxBulkItems caps the size of a single save or delete request.
+	maxBulkItems = 5000
+	// bulkChunkTimeout is the time budget for one round of concurrent chunks.
+	bulkChunkTimeout = 10 * time.Second
+)
+
+// chunkFunc sends inputs[start:end] to Erply and returns the results of
+// those items, indexed from 0.
+type chunkFunc func(ctx context.Context, start, end int) ([]ItemResult, error)
+
+// bulkTimeout is the time budget for sending n items in chunks.
+func bulkTimeout(n int) time.Duration {
+	chunks := (n + bulkChunkSize - 1) / bulkChunkSize
+	rounds := (chunks + bulkConcurrency - 1) / bulkConcurrency
+	return time.Duration(rounds) * bulkChunkTimeout
+}
+
+// runChunked splits n items into chunks of at most bulkChunkSize, sends them
+// with bounded concurrency and merges the results back in input order. Items
+// of a chunk that failed as a whole are reported as failed with its error. The error is only
+// returned when every chunk failed, so the caller can answer with it instead
+// of a list of identical failures.
+func runChunked(ctx context.Context, ids []int, send chunkFunc) ([]ItemResult, error) {
+	n := len(ids)
+	type chunk struct {
+		start, end int
+		results    []ItemResult
+		err        error
+	}
+	var chunks []*chunk
+	for start := 0; start < n; start += bulkChunkSize {
+		chunks = append(chunks, &chunk{start: start, end: min(start+bulkChunkSize, n)})
+	}
+
+	sem := make(chan struct{}, bulkConcurrency)
+	var wg sync.WaitGroup
+	for _, ch := range chunks {
+		wg.Add(1)
+		go func(ch *chunk) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				ch.err = ctx.Err()
+				return
+			}
+			ch.results, ch.err = send(ctx, ch.start, ch.end)
+		}(ch)
+	}
+	wg.Wait()
+
+	results := make([]ItemResult, 0, n)
+	failedChunks := 0
+	var firstErr error
+	for _, ch := range chunks {
+		if ch.err != nil && len(ch.results) == 0 {
+			failedChunks++
+			if firstErr == nil {
+				firstErr = ch.err
+			}
+			e := erplyerr.From(ch.err)
+			for i := ch.start; i < ch.end; i++ {
+				results = append(results, withError(ItemResult{Index: i, CustomerID: ids[i]}, e))
+			}
+			continue
+		}
+		for _, res := range ch.results {
+			res.Index += ch.start
+			results = append(results, res)
+		}
+	}
+	if failedChunks == len(chunks) {
+		return nil, firstErr
+	}
+	return results, nil
+}
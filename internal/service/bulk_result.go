@@ -0,0 +1,188 @@
+package service
+
+import (
+	"erply_test/internal/erplyerr"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+)
+
+const (
+	ItemCreated  = "created"
+	ItemUpdated  = "updated"
+	ItemDeleted  = "deleted"
+	ItemNotFound = "not_found"
+	ItemFailed   = "failed"
+)
+
+// ItemResult is the outcome of one item of a bulk save or delete request.
+type ItemResult struct {
+	Index      int    `json:"index"`
+	CustomerID int    `json:"customerID,omitempty"`
+	Status     string `json:"status" enums:"created,updated,deleted,not_found,failed"`
+	ErrorCode  int    `json:"errorCode,omitempty"`
+	Field      string `json:"field,omitempty"`
+	// Error is the error code of a failed item, as in error responses, e.g.
+	// upstream_quota_exhausted.
+	Error erplyerr.Kind `json:"error,omitempty" swaggertype:"string"`
+	// RetryAfter is in how many seconds a failed item may be retried, when
+	// that is known.
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+type BulkSummary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+type BulkResponse struct {
+	Results []ItemResult `json:"results"`
+	Summary BulkSummary  `json:"summary"`
+}
+
+func (r ItemResult) succeeded() bool {
+	return r.Status == ItemCreated || r.Status == ItemUpdated || r.Status == ItemDeleted
+}
+
+func newBulkResponse(results []ItemResult) BulkResponse {
+	resp := BulkResponse{Results: results}
+	for _, r := range results {
+		if r.succeeded() {
+			resp.Summary.Succeeded++
+		} else {
+			resp.Summary.Failed++
+		}
+	}
+	return resp
+}
+
+// HTTPStatus is 200 when every item succeeded and 207 when some did. When
+// none did it is the status of the item errors, the highest one if they
+// differ.
+func (r BulkResponse) HTTPStatus() int {
+	switch {
+	case r.Summary.Failed == 0:
+		return http.StatusOK
+	case r.Summary.Succeeded > 0:
+		return http.StatusMultiStatus
+	}
+	status := 0
+	for _, res := range r.Results {
+		status = max(status, res.Error.HTTPStatus())
+	}
+	return status
+}
+
+// RetryAfter is how long to wait before retrying a request of which no item
+// succeeded, the longest wait of its items, or 0.
+func (r BulkResponse) RetryAfter() time.Duration {
+	if r.Summary.Succeeded > 0 {
+		return 0
+	}
+	seconds := 0
+	for _, res := range r.Results {
+		seconds = max(seconds, res.RetryAfter)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// failedResult fills in the error details of a failed item from its Erply
+// status.
+func failedResult(res ItemResult, status sharedCommon.StatusBulk) ItemResult {
+	res = withError(res, erplyerr.FromStatus(status.Status))
+	if res.Error == erplyerr.KindNotFound {
+		res.Status = ItemNotFound
+	}
+	return res
+}
+
+// withError marks res failed with e.
+func withError(res ItemResult, e *erplyerr.Error) ItemResult {
+	res.Status = ItemFailed
+	res.ErrorCode = e.ErplyCode
+	res.Field = e.Field
+	res.Error = e.Kind
+	res.RetryAfter = int(math.Ceil(e.RetryAfter.Seconds()))
+	return res
+}
+
+func isOK(status sharedCommon.StatusBulk) bool {
+	return strings.EqualFold(status.ResponseStatus, "ok")
+}
+
+// saveResults maps the bulk items of a save response to the inputs. Items
+// are returned by Erply in request order. ids holds the customerID of each
+// input, or 0 for new customers.
+func saveResults(ids []int, resp customers.SaveCustomerResponseBulk) []ItemResult {
+	results := make([]ItemResult, len(ids))
+	for i, id := range ids {
+		res := ItemResult{Index: i, CustomerID: id}
+		if i >= len(resp.BulkItems) {
+			results[i] = failedResult(res, sharedCommon.StatusBulk{})
+			continue
+		}
+		item := resp.BulkItems[i]
+		if !isOK(item.Status) {
+			results[i] = failedResult(res, item.Status)
+			continue
+		}
+		res.Status = ItemCreated
+		if id != 0 {
+			res.Status = ItemUpdated
+		}
+		if len(item.Records) > 0 {
+			res.CustomerID = item.Records[0].CustomerID
+			if item.Records[0].AlreadyExists {
+				res.Status = ItemUpdated
+			}
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// deleteResults maps the bulk items of a delete response to the inputs.
+func deleteResults(ids []int, resp customers.DeleteCustomersResponseBulk) []ItemResult {
+	results := make([]ItemResult, len(ids))
+	for i, id := range ids {
+		res := ItemResult{Index: i, CustomerID: id}
+		switch {
+		case i >= len(resp.BulkItems):
+			results[i] = failedResult(res, sharedCommon.StatusBulk{})
+		case !isOK(resp.BulkItems[i].Status):
+			results[i] = failedResult(res, resp.BulkItems[i].Status)
+		default:
+			res.Status = ItemDeleted
+			results[i] = res
+		}
+	}
+	return results
+}
+
+func getStatuses(resp customers.GetCustomersResponseBulk) []sharedCommon.StatusBulk {
+	statuses := make([]sharedCommon.StatusBulk, 0, len(resp.BulkItems))
+	for _, item := range resp.BulkItems {
+		statuses = append(statuses, item.Status)
+	}
+	return statuses
+}
+
+func saveStatuses(resp customers.SaveCustomerResponseBulk) []sharedCommon.StatusBulk {
+	statuses := make([]sharedCommon.StatusBulk, 0, len(resp.BulkItems))
+	for _, item := range resp.BulkItems {
+		statuses = append(statuses, item.Status)
+	}
+	return statuses
+}
+
+func deleteStatuses(resp customers.DeleteCustomersResponseBulk) []sharedCommon.StatusBulk {
+	statuses := make([]sharedCommon.StatusBulk, 0, len(resp.BulkItems))
+	for _, item := range resp.BulkItems {
+		statuses = append(statuses, item.Status)
+	}
+	return statuses
+}
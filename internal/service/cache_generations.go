@@ -0,0 +1,66 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// generationKeep is how long a write is remembered. It outlasts the longest
+// fill, sharedFetchLimit or refreshLimit.
+const generationKeep = time.Minute
+
+// generations records which cache keys and tags this instance invalidated,
+// so that a fill that fetched before a write does not cache what it read
+// over the write.
+type generations struct {
+	mu  sync.Mutex
+	seq uint64
+	// written holds the generation and time of the last write to a key or
+	// tag.
+	written map[string]generation
+}
+
+type generation struct {
+	seq uint64
+	at  time.Time
+}
+
+// current returns the generation a fill starts from.
+func (g *generations) current() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.seq
+}
+
+// bump records a write to names and forgets writes older than
+// generationKeep.
+func (g *generations) bump(names ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if g.written == nil {
+		g.written = map[string]generation{}
+	}
+	for name, w := range g.written {
+		if now.Sub(w.at) > generationKeep {
+			delete(g.written, name)
+		}
+	}
+	g.seq++
+	for _, name := range names {
+		g.written[name] = generation{seq: g.seq, at: now}
+	}
+}
+
+// changedSince reports whether any of names was written after generation
+// seq.
+func (g *generations) changedSince(seq uint64, names ...string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, name := range names {
+		if w, ok := g.written[name]; ok && w.seq > seq {
+			return true
+		}
+	}
+	return false
+}
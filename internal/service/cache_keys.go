@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cache keys:
+//
+//	customer:<id>                              one customer (CustomerEntry)
+//	customers:list:<filter hash>:<page>:<size> one list page (CustomerPage)
+//
+// List pages are tagged with the customers they contain and with their
+// filters, so a write drops only the pages it can change:
+//
+//	customer:<id>          pages showing the customer
+//	filter:none            unfiltered listings
+//	filter:name            listings searching by name
+//	filter:changedSince    listings of recently changed customers
+//	filter:<field>=<value> exact-match lookups by email, phone, code or groupID
+
+const (
+	tagUnfiltered   = "filter:none"
+	tagNameSearch   = "filter:name"
+	tagChangedSince = "filter:changedSince"
+)
+
+func customerCacheKey(id int) string {
+	return "customer:" + strconv.Itoa(id)
+}
+
+func customerTag(id int) string {
+	return "customer:" + strconv.Itoa(id)
+}
+
+func filterTag(field, value string) string {
+	if field == "email" {
+		value = strings.ToLower(value)
+	}
+	return "filter:" + field + "=" + value
+}
+
+// listCacheKey returns the key of one page of the listing with the given
+// filters.
+func listCacheKey(q ListQuery) string {
+	sum := sha256.Sum256([]byte(q.filterValues().Encode()))
+	return fmt.Sprintf("customers:list:%s:%d:%d", hex.EncodeToString(sum[:8]), q.PageNo, q.RecordsOnPage)
+}
+
+// listTags returns the tags of a cached list page: its filters and the
+// customers on it.
+func listTags(q ListQuery, page CustomerPage) []string {
+	var tags []string
+	if q.Name != "" {
+		tags = append(tags, tagNameSearch)
+	}
+	if q.Email != "" {
+		tags = append(tags, filterTag("email", q.Email))
+	}
+	if q.Phone != "" {
+		tags = append(tags, filterTag("phone", q.Phone))
+	}
+	if q.Code != "" {
+		tags = append(tags, filterTag("code", q.Code))
+	}
+	if q.GroupID != 0 {
+		tags = append(tags, filterTag("groupID", strconv.Itoa(q.GroupID)))
+	}
+	if q.ChangedSince != 0 {
+		tags = append(tags, tagChangedSince)
+	}
+	if len(tags) == 0 {
+		tags = append(tags, tagUnfiltered)
+	}
+	for _, c := range page.Customers {
+		tags = append(tags, customerTag(c.ID))
+	}
+	return tags
+}
+
+// customerChange is a write to one customer, used to find the cached list
+// pages it can change.
+type customerChange struct {
+	id      int
+	created bool
+	deleted bool
+	// input is the saveCustomer input of a create or update.
+	input map[string]interface{}
+}
+
+// tags returns the tags of the list pages the change can affect:
+//   - pages showing the customer,
+//   - unfiltered listings, when the number of customers changes,
+//   - changedSince listings, which every saved customer now matches,
+//   - listings filtering by a value the customer was saved with.
+//
+// A customer leaving a filtered listing it was not shown in yet, for example
+// through a delete, is not tracked; those pages expire with their TTL.
+func (c customerChange) tags() []string {
+	var tags []string
+	if c.id != 0 {
+		tags = append(tags, customerTag(c.id))
+	}
+	if c.created || c.deleted {
+		tags = append(tags, tagUnfiltered)
+	}
+	if c.deleted {
+		return tags
+	}
+	tags = append(tags, tagChangedSince)
+	for _, field := range []string{"email", "phone", "code", "groupID"} {
+		if v, ok := c.input[field]; ok && v != "" {
+			tags = append(tags, filterTag(field, fmt.Sprint(v)))
+		}
+	}
+	for _, field := range []string{"firstName", "lastName", "companyName"} {
+		if _, ok := c.input[field]; ok {
+			tags = append(tags, tagNameSearch)
+			break
+		}
+	}
+	return tags
+}
+
+// invalidate drops the cached entries of the changed customers and the list
+// pages the changes can affect, including those being filled right now on
+// this instance.
+func (s *CustomerService) invalidate(ctx context.Context, changes ...customerChange) {
+	if len(changes) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(changes))
+	seen := map[string]bool{}
+	var tags []string
+	for _, c := range changes {
+		if c.id != 0 {
+			keys = append(keys, customerCacheKey(c.id))
+		}
+		for _, tag := range c.tags() {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	// Fills that are fetching now read from before the write; they must not
+	// cache what they read.
+	s.generations.bump(append(keys, tags...)...)
+	if len(keys) > 0 {
+		if err := s.cache.Delete(ctx, keys...); err != nil {
+			s.logger.Error("error deleting customers from cache", "error", err)
+		}
+	}
+	if err := s.cache.InvalidateTags(ctx, tags...); err != nil {
+		s.logger.Error("error invalidating customer listings", "error", err)
+	}
+}
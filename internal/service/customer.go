@@ -0,0 +1,116 @@
+package service
+
+import (
+	"time"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+)
+
+// Source tells where a result was read from.
+const (
+	SourceCache    = "cache"
+	SourceUpstream = "upstream"
+	// SourceStale is an expired cache entry served while it is refreshed.
+	SourceStale = "stale"
+)
+
+// Customer is the customer representation returned to API clients.
+type Customer struct {
+	ID           int                 `json:"id"`
+	Type         string              `json:"type,omitempty"`
+	FullName     string              `json:"fullName,omitempty"`
+	FirstName    string              `json:"firstName,omitempty"`
+	LastName     string              `json:"lastName,omitempty"`
+	CompanyName  string              `json:"companyName,omitempty"`
+	Email        string              `json:"email,omitempty"`
+	Phone        string              `json:"phone,omitempty"`
+	Mobile       string              `json:"mobile,omitempty"`
+	Fax          string              `json:"fax,omitempty"`
+	Code         string              `json:"code,omitempty"`
+	VatNumber    string              `json:"vatNumber,omitempty"`
+	GroupID      int                 `json:"groupID,omitempty"`
+	GroupName    string              `json:"groupName,omitempty"`
+	Address      string              `json:"address,omitempty"`
+	Birthday     string              `json:"birthday,omitempty"`
+	Gender       string              `json:"gender,omitempty"`
+	Notes        string              `json:"notes,omitempty"`
+	PaymentDays  int                 `json:"paymentDays,omitempty"`
+	CreditLimit  int                 `json:"creditLimit,omitempty"`
+	TaxExempt    bool                `json:"taxExempt,omitempty"`
+	EmailEnabled bool                `json:"emailEnabled,omitempty"`
+	MailEnabled  bool                `json:"mailEnabled,omitempty"`
+	EmailOptOut  bool                `json:"emailOptOut,omitempty"`
+	Attributes   []CustomerAttribute `json:"attributes,omitempty"`
+	LastModified int                 `json:"lastModified,omitempty"`
+}
+
+// CustomerPage is one normalized page of customers. This is also the form
+// stored in the cache.
+type CustomerPage struct {
+	Customers []Customer `json:"customers"`
+	Total     int        `json:"total"`
+	FetchedAt time.Time  `json:"fetchedAt"`
+}
+
+// CustomerEntry is a single customer as stored in the cache.
+type CustomerEntry struct {
+	Customer  Customer  `json:"customer"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+func newCustomer(c customers.Customer) Customer {
+	return Customer{
+		ID:           c.ID,
+		Type:         c.CustomerType,
+		FullName:     c.FullName,
+		FirstName:    c.FirstName,
+		LastName:     c.LastName,
+		CompanyName:  c.CompanyName,
+		Email:        c.Email,
+		Phone:        c.Phone,
+		Mobile:       c.Mobile,
+		Fax:          c.Fax,
+		Code:         c.Code,
+		VatNumber:    c.VatNumber,
+		GroupID:      c.GroupID,
+		GroupName:    c.GroupName,
+		Address:      c.Address,
+		Birthday:     c.Birthday,
+		Gender:       c.Gender,
+		Notes:        c.Notes,
+		PaymentDays:  c.PaymentDays,
+		CreditLimit:  c.Credit,
+		TaxExempt:    c.TaxExempt == 1,
+		EmailEnabled: c.EmailEnabled == 1,
+		MailEnabled:  c.MailEnabled == 1,
+		EmailOptOut:  c.EmailOptOut == 1,
+		Attributes:   newAttributes(c.Attributes),
+		LastModified: c.LastModified,
+	}
+}
+
+func newAttributes(attrs []sharedCommon.ObjAttribute) []CustomerAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	result := make([]CustomerAttribute, 0, len(attrs))
+	for _, a := range attrs {
+		result = append(result, CustomerAttribute{Name: a.AttributeName, Type: a.AttributeType, Value: a.AttributeValue})
+	}
+	return result
+}
+
+// newCustomerPage flattens an Erply bulk response into a CustomerPage.
+func newCustomerPage(resp customers.GetCustomersResponseBulk, fetchedAt time.Time) CustomerPage {
+	page := CustomerPage{Customers: []Customer{}, FetchedAt: fetchedAt}
+	for i, item := range resp.BulkItems {
+		if i == 0 {
+			page.Total = item.Status.RecordsTotal
+		}
+		for _, c := range item.Customers {
+			page.Customers = append(page.Customers, newCustomer(c))
+		}
+	}
+	return page
+}
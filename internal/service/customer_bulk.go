@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// maxCustomerID is the largest ID Erply gives a customer.
+const maxCustomerID = math.MaxInt32
+
+// ParseCustomerIDs converts customer IDs given as JSON numbers or strings.
+// Fractional and out of range IDs are rejected rather than rounded, as they
+// would name a different customer.
+func ParseCustomerIDs(raw []interface{}) ([]int, error) {
+	ids := make([]int, 0, len(raw))
+	for _, id := range raw {
+		var idStr string
+		switch v := id.(type) {
+		case float64:
+			idStr = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			idStr = v
+		default:
+			return nil, erplyerr.BadRequest("invalid customer ID type")
+		}
+		n, err := strconv.Atoi(idStr)
+		if err != nil || n <= 0 || n > maxCustomerID {
+			return nil, erplyerr.BadRequest("invalid customer ID: " + idStr)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
+
+// SaveCustomers validates and saves customers in chunks and returns a result
+// per customer. An error is returned when the input is rejected or every
+// chunk failed.
+func (s *CustomerService) SaveCustomers(ctx context.Context, custs []SaveCustomer) (BulkResponse, error) {
+	if len(custs) == 0 {
+		return BulkResponse{}, erplyerr.BadRequest("no customers to save")
+	}
+	if len(custs) > maxBulkItems {
+		return BulkResponse{}, erplyerr.BadRequest(fmt.Sprintf("at most %d customers can be saved at once", maxBulkItems))
+	}
+	if violations := validateCustomers(custs); len(violations) > 0 {
+		return BulkResponse{}, erplyerr.Invalid(violations)
+	}
+
+	bulk := make([]map[string]interface{}, 0, len(custs))
+	ids := make([]int, len(custs))
+	for i, cust := range custs {
+		if cust.CustomerID != nil {
+			ids[i] = *cust.CustomerID
+		}
+		bulk = append(bulk, cust.toMap())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, bulkTimeout(len(bulk)))
+	defer cancel()
+
+	results, err := runChunked(ctx, ids, func(ctx context.Context, start, end int) ([]ItemResult, error) {
+		saveResp, err := s.customerManager.SaveCustomerBulk(ctx, bulk[start:end], map[string]string{})
+		if err != nil && len(saveResp.BulkItems) == 0 {
+			return nil, err
+		}
+		return saveResults(ids[start:end], saveResp), nil
+	})
+	if err != nil {
+		return BulkResponse{}, erplyerr.From(err)
+	}
+
+	resp := newBulkResponse(results)
+	if resp.Summary.Failed > 0 {
+		s.logger.Warn("some customers were not saved", "failed", resp.Summary.Failed)
+	}
+	var changes []customerChange
+	for _, res := range resp.Results {
+		if res.succeeded() && res.CustomerID != 0 {
+			changes = append(changes, customerChange{id: res.CustomerID, created: res.Status == ItemCreated, input: bulk[res.Index]})
+		}
+	}
+	s.invalidate(ctx, changes...)
+	return resp, nil
+}
+
+// DeleteCustomers deletes customers in chunks and returns a result per ID. An
+// error is returned when the input is rejected or every chunk failed.
+func (s *CustomerService) DeleteCustomers(ctx context.Context, ids []int) (BulkResponse, error) {
+	if len(ids) == 0 {
+		return BulkResponse{}, erplyerr.BadRequest("no customer IDs provided")
+	}
+	if len(ids) > maxBulkItems {
+		return BulkResponse{}, erplyerr.BadRequest(fmt.Sprintf("at most %d customer IDs can be deleted at once", maxBulkItems))
+	}
+
+	bulk := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		bulk = append(bulk, map[string]interface{}{"customerID": strconv.Itoa(id)})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, bulkTimeout(len(ids)))
+	defer cancel()
+
+	results, err := runChunked(ctx, ids, func(ctx context.Context, start, end int) ([]ItemResult, error) {
+		deleteResp, err := s.customerManager.DeleteCustomerBulk(ctx, bulk[start:end], map[string]string{})
+		if err != nil && len(deleteResp.BulkItems) == 0 {
+			return nil, err
+		}
+		return deleteResults(ids[start:end], deleteResp), nil
+	})
+	if err != nil {
+		return BulkResponse{}, erplyerr.From(err)
+	}
+
+	resp := newBulkResponse(results)
+	if resp.Summary.Failed > 0 {
+		s.logger.Warn("some customers were not deleted", "failed", resp.Summary.Failed)
+	}
+	changes := make([]customerChange, 0, len(ids))
+	for _, id := range ids {
+		changes = append(changes, customerChange{id: id, deleted: true})
+	}
+	s.invalidate(ctx, changes...)
+	return resp, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"time"
+
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+)
+
+const (
+	// exportRecordsOnPage is the largest page Erply returns.
+	exportRecordsOnPage = 100
+	// exportPagesPerCall is how many pages are requested in one bulk call.
+	exportPagesPerCall = 10
+	// exportCallTimeout is the time budget of one bulk call.
+	exportCallTimeout = 30 * time.Second
+)
+
+// ExportFunc receives one batch of exported customers. total is the number of
+// customers matching the filters. Returning an error stops the export.
+type ExportFunc func(total int, batch []Customer) error
+
+// ExportCustomers reads every customer matching the filters of query from
+// Erply, bypassing the cache, and passes them to emit in batches. Paging
+// fields of query are ignored. The export stops when ctx is cancelled.
+func (s *CustomerService) ExportCustomers(ctx context.Context, query ListQuery, emit ExportFunc) error {
+	query.RecordsOnPage = exportRecordsOnPage
+	for pageNo := 1; ; pageNo += exportPagesPerCall {
+		resp, err := s.fetchExportPages(ctx, query, pageNo)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return erplyerr.FromBulk(err, getStatuses(resp)...)
+		}
+
+		total := 0
+		if len(resp.BulkItems) > 0 {
+			total = resp.BulkItems[0].Status.RecordsTotal
+		}
+		done := len(resp.BulkItems) < exportPagesPerCall
+		batch := make([]Customer, 0, exportPagesPerCall*exportRecordsOnPage)
+		for _, item := range resp.BulkItems {
+			for _, cust := range item.Customers {
+				batch = append(batch, newCustomer(cust))
+			}
+			if len(item.Customers) < exportRecordsOnPage {
+				done = true
+				break
+			}
+		}
+		if err := emit(total, batch); err != nil {
+			return err
+		}
+		if done || (pageNo+exportPagesPerCall-1)*exportRecordsOnPage >= total {
+			return nil
+		}
+	}
+}
+
+// fetchExportPages requests exportPagesPerCall pages starting from firstPage
+// in one bulk call.
+func (s *CustomerService) fetchExportPages(ctx context.Context, query ListQuery, firstPage int) (customers.GetCustomersResponseBulk, error) {
+	ctx, cancel := context.WithTimeout(ctx, exportCallTimeout)
+	defer cancel()
+
+	filters := make([]map[string]interface{}, 0, exportPagesPerCall)
+	for i := 0; i < exportPagesPerCall; i++ {
+		query.PageNo = firstPage + i
+		filters = append(filters, query.Filter())
+	}
+	return s.customerManager.GetCustomersBulk(ctx, filters, map[string]string{})
+}
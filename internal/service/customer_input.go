@@ -0,0 +1,151 @@
+package service
+
+import "strconv"
+
+// SaveCustomer is a customer as sent by clients to create or update it.
+// Code is the registry code of a company or the personal ID code of a person.
+// Numbers and flags are pointers, so a partial update can tell a missing
+// field from a zero value.
+type SaveCustomer struct {
+	CustomerID   *int                `json:"customerID,omitempty" validate:"omitempty,min=1"`
+	FirstName    string              `json:"firstName,omitempty" validate:"max=255"`
+	LastName     string              `json:"lastName,omitempty" validate:"max=255"`
+	CompanyName  string              `json:"companyName,omitempty" validate:"max=255"`
+	Email        string              `json:"email,omitempty" validate:"omitempty,max=255,email"`
+	Phone        string              `json:"phone,omitempty" validate:"omitempty,phone"`
+	Mobile       string              `json:"mobile,omitempty" validate:"omitempty,phone"`
+	Fax          string              `json:"fax,omitempty" validate:"omitempty,phone"`
+	Website      string              `json:"website,omitempty" validate:"max=255"`
+	Address      string              `json:"address,omitempty" validate:"max=255"`
+	Code         string              `json:"code,omitempty" validate:"max=100"`
+	VatNumber    string              `json:"vatNumber,omitempty" validate:"max=50"`
+	GroupID      *int                `json:"groupID,omitempty" validate:"omitempty,min=1"`
+	Birthday     string              `json:"birthday,omitempty" validate:"omitempty,datetime=2006-01-02" example:"1990-12-31"`
+	Gender       string              `json:"gender,omitempty" validate:"omitempty,oneof=male female" enums:"male,female"`
+	Notes        string              `json:"notes,omitempty" validate:"max=2000"`
+	PaymentDays  *int                `json:"paymentDays,omitempty" validate:"omitempty,min=0,max=365"`
+	CreditLimit  *int                `json:"creditLimit,omitempty" validate:"omitempty,min=0"`
+	TaxExempt    *bool               `json:"taxExempt,omitempty"`
+	EmailEnabled *bool               `json:"emailEnabled,omitempty"`
+	MailEnabled  *bool               `json:"mailEnabled,omitempty"`
+	EmailOptOut  *bool               `json:"emailOptOut,omitempty"`
+	Attributes   []CustomerAttribute `json:"attributes,omitempty" validate:"max=50,dive"`
+}
+
+// CustomerAttribute is a custom attribute of a customer.
+type CustomerAttribute struct {
+	Name  string `json:"name" validate:"required,max=255"`
+	Type  string `json:"type,omitempty" validate:"omitempty,oneof=text int double" enums:"text,int,double" example:"text"`
+	Value string `json:"value" validate:"max=255"`
+}
+
+// textFields returns the text fields keyed by their Erply saveCustomer name.
+func (c SaveCustomer) textFields() map[string]string {
+	return map[string]string{
+		"firstName":   c.FirstName,
+		"lastName":    c.LastName,
+		"companyName": c.CompanyName,
+		"email":       c.Email,
+		"phone":       c.Phone,
+		"mobile":      c.Mobile,
+		"fax":         c.Fax,
+		"website":     c.Website,
+		"address":     c.Address,
+		"code":        c.Code,
+		"vatNumber":   c.VatNumber,
+		"birthday":    c.Birthday,
+		"gender":      c.Gender,
+		"notes":       c.Notes,
+	}
+}
+
+// toMap returns the saveCustomer input for Erply. Empty fields are left out,
+// so they keep their current value on update.
+func (c SaveCustomer) toMap() map[string]interface{} {
+	m := map[string]interface{}{}
+	for name, value := range c.textFields() {
+		if value != "" {
+			m[name] = value
+		}
+	}
+	c.addOptional(m)
+	return m
+}
+
+// toReplaceMap returns the saveCustomer input for a full replace: every
+// field is sent, so fields left out are cleared. Text is sent empty, numbers
+// and flags as 0, and the attributes in current that are not given with an
+// empty value.
+func (c SaveCustomer) toReplaceMap(current []CustomerAttribute) map[string]interface{} {
+	m := map[string]interface{}{}
+	for name, value := range c.textFields() {
+		m[name] = value
+	}
+	for _, name := range []string{"groupID", "paymentDays", "credit", "taxExempt", "emailEnabled", "mailEnabled", "emailOptOut"} {
+		m[name] = 0
+	}
+	c.addOptional(m)
+
+	given := map[string]bool{}
+	for _, attr := range c.Attributes {
+		given[attr.Name] = true
+	}
+	n := len(c.Attributes)
+	for _, attr := range current {
+		if given[attr.Name] {
+			continue
+		}
+		n++
+		m["attributeName"+strconv.Itoa(n)] = attr.Name
+		m["attributeType"+strconv.Itoa(n)] = attr.Type
+		m["attributeValue"+strconv.Itoa(n)] = ""
+	}
+	return m
+}
+
+// addOptional adds the ID, numbers, flags and attributes that are set.
+// Erply expects flags as 0 or 1 and attributes as numbered
+// attributeName/attributeType/attributeValue fields.
+func (c SaveCustomer) addOptional(m map[string]interface{}) {
+	if c.CustomerID != nil {
+		m["customerID"] = *c.CustomerID
+	}
+	if c.GroupID != nil {
+		m["groupID"] = *c.GroupID
+	}
+	if c.PaymentDays != nil {
+		m["paymentDays"] = *c.PaymentDays
+	}
+	if c.CreditLimit != nil {
+		m["credit"] = *c.CreditLimit
+	}
+	if c.TaxExempt != nil {
+		m["taxExempt"] = boolToInt(*c.TaxExempt)
+	}
+	if c.EmailEnabled != nil {
+		m["emailEnabled"] = boolToInt(*c.EmailEnabled)
+	}
+	if c.MailEnabled != nil {
+		m["mailEnabled"] = boolToInt(*c.MailEnabled)
+	}
+	if c.EmailOptOut != nil {
+		m["emailOptOut"] = boolToInt(*c.EmailOptOut)
+	}
+	for i, attr := range c.Attributes {
+		n := strconv.Itoa(i + 1)
+		m["attributeName"+n] = attr.Name
+		attrType := attr.Type
+		if attrType == "" {
+			attrType = "text"
+		}
+		m["attributeType"+n] = attrType
+		m["attributeValue"+n] = attr.Value
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const defaultRecordsOnPage = 20
+
+// ListQuery selects one page of customers.
+type ListQuery struct {
+	PageNo        int
+	RecordsOnPage int
+	Name          string
+	Email         string
+	Phone         string
+	Code          string
+	GroupID       int
+	ChangedSince  int64
+}
+
+// ApplyDefaults fills in the page number and page size when they are not set.
+func (q *ListQuery) ApplyDefaults() {
+	if q.PageNo == 0 {
+		q.PageNo = 1
+	}
+	if q.RecordsOnPage == 0 {
+		q.RecordsOnPage = defaultRecordsOnPage
+	}
+}
+
+// Filter converts the query into an Erply getCustomers filter.
+func (q ListQuery) Filter() map[string]interface{} {
+	filter := map[string]interface{}{
+		"pageNo":        q.PageNo,
+		"recordsOnPage": q.RecordsOnPage,
+	}
+	if q.Name != "" {
+		filter["searchName"] = q.Name
+	}
+	if q.Email != "" {
+		filter["email"] = q.Email
+	}
+	if q.Phone != "" {
+		filter["phone"] = q.Phone
+	}
+	if q.Code != "" {
+		filter["code"] = q.Code
+	}
+	if q.GroupID != 0 {
+		filter["groupID"] = q.GroupID
+	}
+	if q.ChangedSince != 0 {
+		filter["changedSince"] = q.ChangedSince
+	}
+	return filter
+}
+
+// Values returns the query as url.Values, named as in GET /api/customers.
+func (q ListQuery) Values() url.Values {
+	v := q.filterValues()
+	v.Set("pageNo", strconv.Itoa(q.PageNo))
+	v.Set("recordsOnPage", strconv.Itoa(q.RecordsOnPage))
+	return v
+}
+
+// filterValues returns the filters of the query without paging. Encode()
+// sorts the keys, so the encoded form is stable and can be hashed into a
+// cache key.
+func (q ListQuery) filterValues() url.Values {
+	v := url.Values{}
+	if q.Name != "" {
+		v.Set("name", q.Name)
+	}
+	if q.Email != "" {
+		v.Set("email", q.Email)
+	}
+	if q.Phone != "" {
+		v.Set("phone", q.Phone)
+	}
+	if q.Code != "" {
+		v.Set("code", q.Code)
+	}
+	if q.GroupID != 0 {
+		v.Set("groupID", strconv.Itoa(q.GroupID))
+	}
+	if q.ChangedSince != 0 {
+		v.Set("changedSince", strconv.FormatInt(q.ChangedSince, 10))
+	}
+	return v
+}
+
+// ListCustomers returns one page of customers from the cache, or from Erply
+// when it is not cached or opts ask for fresher data, together with the
+// source it was read from.
+func (s *CustomerService) ListCustomers(ctx context.Context, query ListQuery, opts ReadOptions) (CustomerPage, string, error) {
+	query.ApplyDefaults()
+
+	return readThrough(ctx, s, s.pages, listCacheKey(query), s.listCache, opts, func(ctx context.Context) (CustomerPage, []string, error) {
+		resp, err := s.customerManager.GetCustomersBulk(ctx, []map[string]interface{}{query.Filter()}, map[string]string{})
+		if err != nil {
+			return CustomerPage{}, nil, erplyerr.FromBulk(err, getStatuses(resp)...)
+		}
+		page := newCustomerPage(resp, time.Now().UTC())
+		return page, listTags(query, page), nil
+	})
+}
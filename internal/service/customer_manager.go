@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/quota"
+	"errors"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+)
+
+type CustomerManagerInterface interface {
+	GetCustomersBulk(ctx context.Context, filters []map[string]interface{}, opts map[string]string) (customers.GetCustomersResponseBulk, error)
+	DeleteCustomerBulk(ctx context.Context, bulk []map[string]interface{}, opts map[string]string) (customers.DeleteCustomersResponseBulk, error)
+	SaveCustomerBulk(ctx context.Context, bulk []map[string]interface{}, opts map[string]string) (customers.SaveCustomerResponseBulk, error)
+}
+
+// quotaCustomerManager counts every call against the Erply quota before
+// sending it. Erply counts each sub-request of a bulk call, so a call costs
+// as many requests as it has items.
+type quotaCustomerManager struct {
+	CustomerManagerInterface
+	quota *quota.Governor
+}
+
+// check tells the governor when Erply refused a call for the hourly limit.
+func (m *quotaCustomerManager) check(ctx context.Context, err error) {
+	var erplyErr *sharedCommon.ErplyError
+	if errors.As(err, &erplyErr) && erplyErr.Code == sharedCommon.HourlyRequestQuota {
+		m.quota.MarkExhausted(ctx)
+	}
+}
+
+// WithQuota sends the calls of m only while the governor allows them.
+func WithQuota(m CustomerManagerInterface, g *quota.Governor) CustomerManagerInterface {
+	return &quotaCustomerManager{CustomerManagerInterface: m, quota: g}
+}
+
+// CheckWithQuota counts the Erply calls of a health check. They are never
+// refused, as the service still serves cached customers when the quota is
+// used up, but Erply refusing them marks the quota exhausted.
+func CheckWithQuota(check func(ctx context.Context) error, g *quota.Governor) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		g.Record(ctx)
+		err := check(ctx)
+		if erplyerr.Is(err, erplyerr.KindQuotaExhausted) {
+			g.MarkExhausted(ctx)
+		}
+		return err
+	}
+}
+
+func (m *quotaCustomerManager) GetCustomersBulk(ctx context.Context, filters []map[string]interface{}, opts map[string]string) (customers.GetCustomersResponseBulk, error) {
+	if err := m.quota.Acquire(ctx, len(filters)); err != nil {
+		return customers.GetCustomersResponseBulk{}, err
+	}
+	resp, err := m.CustomerManagerInterface.GetCustomersBulk(ctx, filters, opts)
+	m.check(ctx, err)
+	return resp, err
+}
+
+func (m *quotaCustomerManager) DeleteCustomerBulk(ctx context.Context, bulk []map[string]interface{}, opts map[string]string) (customers.DeleteCustomersResponseBulk, error) {
+	if err := m.quota.Acquire(ctx, len(bulk)); err != nil {
+		return customers.DeleteCustomersResponseBulk{}, err
+	}
+	resp, err := m.CustomerManagerInterface.DeleteCustomerBulk(ctx, bulk, opts)
+	m.check(ctx, err)
+	return resp, err
+}
+
+func (m *quotaCustomerManager) SaveCustomerBulk(ctx context.Context, bulk []map[string]interface{}, opts map[string]string) (customers.SaveCustomerResponseBulk, error) {
+	if err := m.quota.Acquire(ctx, len(bulk)); err != nil {
+		return customers.SaveCustomerResponseBulk{}, err
+	}
+	resp, err := m.CustomerManagerInterface.SaveCustomerBulk(ctx, bulk, opts)
+	m.check(ctx, err)
+	return resp, err
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/logger"
+	cache "erply_test/internal/repository"
+	"sync"
+	"time"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheTTL is how long customers and customer listings stay cached unless
+// their CachePolicy says otherwise.
+const CacheTTL = 10 * time.Minute
+
+// CacheSchemaVersion versions the cached form of CustomerEntry and
+// CustomerPage. Bump it whenever they or Customer change shape, so entries
+// written by the previous release read as misses.
+const CacheSchemaVersion = 1
+
+var defaultCachePolicy = CachePolicy{Enabled: true, TTL: CacheTTL}
+
+var errCustomerNotFound = erplyerr.NotFound("customer not found")
+
+// CustomerService reads and writes Erply customers through the cache. Errors
+// are returned as *erplyerr.Error.
+type CustomerService struct {
+	customerManager CustomerManagerInterface
+	cache           cache.CacheInterface
+	logger          logger.LoggerInterface
+	// staleTTL is how long after CacheTTL a cached value is still served
+	// while it is refreshed.
+	staleTTL      time.Duration
+	customerCache CachePolicy
+	listCache     CachePolicy
+	codec         *cache.Codec
+	entries       *cache.Typed[CustomerEntry]
+	pages         *cache.Typed[CustomerPage]
+
+	flight      singleflight.Group
+	refreshing  sync.Map
+	generations generations
+}
+
+// Option configures a CustomerService.
+type Option func(*CustomerService)
+
+// WithStaleWhileRevalidate serves cached values for up to d after they expire,
+// refreshing them in the background.
+func WithStaleWhileRevalidate(d time.Duration) Option {
+	return func(s *CustomerService) {
+		s.staleTTL = d
+	}
+}
+
+// WithCodec sets how cached values are encoded. By default they are stored
+// uncompressed.
+func WithCodec(codec *cache.Codec) Option {
+	return func(s *CustomerService) {
+		s.codec = codec
+	}
+}
+
+// WithCustomerCache sets the cache policy of GetCustomer.
+func WithCustomerCache(p CachePolicy) Option {
+	return func(s *CustomerService) {
+		s.customerCache = p
+	}
+}
+
+// WithListCache sets the cache policy of ListCustomers.
+func WithListCache(p CachePolicy) Option {
+	return func(s *CustomerService) {
+		s.listCache = p
+	}
+}
+
+func NewCustomerService(
+	customerManager CustomerManagerInterface,
+	store cache.CacheInterface,
+	logger logger.LoggerInterface,
+	opts ...Option,
+) *CustomerService {
+	s := &CustomerService{
+		customerManager: customerManager,
+		cache:           store,
+		logger:          logger,
+		customerCache:   defaultCachePolicy,
+		listCache:       defaultCachePolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.codec == nil {
+		s.codec, _ = cache.NewCodec(cache.CompressionNone, 0)
+	}
+	s.entries = cache.NewTyped[CustomerEntry](s.cache, s.codec, CacheSchemaVersion)
+	s.pages = cache.NewTyped[CustomerPage](s.cache, s.codec, CacheSchemaVersion)
+	return s
+}
+
+// CacheHealthy reports whether the cache is usable. While it is not, reads
+// go to Erply.
+func (s *CustomerService) CacheHealthy() bool {
+	if h, ok := s.cache.(cache.HealthReporter); ok {
+		return h.Healthy()
+	}
+	return true
+}
+
+// CustomerCache returns the cache policy of GetCustomer.
+func (s *CustomerService) CustomerCache() CachePolicy {
+	return s.customerCache
+}
+
+// ListCache returns the cache policy of ListCustomers.
+func (s *CustomerService) ListCache() CachePolicy {
+	return s.listCache
+}
+
+// GetCustomer returns a customer from the cache, or from Erply when it is not
+// cached or opts ask for fresher data, together with the source it was read
+// from.
+func (s *CustomerService) GetCustomer(ctx context.Context, id int, opts ReadOptions) (CustomerEntry, string, error) {
+	return readThrough(ctx, s, s.entries, customerCacheKey(id), s.customerCache, opts, func(ctx context.Context) (CustomerEntry, []string, error) {
+		resp, err := s.customerManager.GetCustomersBulk(ctx, []map[string]interface{}{{"customerID": id}}, map[string]string{})
+		if err := customerError(err, getStatuses(resp)); err != nil {
+			return CustomerEntry{}, nil, err
+		}
+		page := newCustomerPage(resp, time.Now().UTC())
+		if len(page.Customers) == 0 {
+			return CustomerEntry{}, nil, errCustomerNotFound
+		}
+		return CustomerEntry{Customer: page.Customers[0], FetchedAt: page.FetchedAt}, nil, nil
+	})
+}
+
+// CreateCustomer validates and creates a customer and returns its ID.
+func (s *CustomerService) CreateCustomer(ctx context.Context, cust SaveCustomer) (int, error) {
+	if cust.CustomerID != nil {
+		return 0, erplyerr.Validation("customerID must not be set on create", "customerID")
+	}
+	if violations := validateCustomer(0, cust, true); len(violations) > 0 {
+		return 0, erplyerr.Invalid(violations)
+	}
+
+	input := cust.toMap()
+	id, err := s.saveCustomer(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+	s.invalidate(ctx, customerChange{id: id, created: true, input: input})
+	return id, nil
+}
+
+// ReplaceCustomer replaces all fields of a customer. Fields left out are
+// cleared.
+func (s *CustomerService) ReplaceCustomer(ctx context.Context, id int, cust SaveCustomer) error {
+	return s.updateCustomer(ctx, id, cust, func(ctx context.Context, c SaveCustomer) (map[string]interface{}, error) {
+		// Erply only clears attributes by name, so the current ones are
+		// needed.
+		resp, err := s.customerManager.GetCustomersBulk(ctx, []map[string]interface{}{{"customerID": id}}, map[string]string{})
+		if err := customerError(err, getStatuses(resp)); err != nil {
+			return nil, err
+		}
+		page := newCustomerPage(resp, time.Now().UTC())
+		if len(page.Customers) == 0 {
+			return nil, errCustomerNotFound
+		}
+		return c.toReplaceMap(page.Customers[0].Attributes), nil
+	}, true)
+}
+
+// PatchCustomer changes only the given fields of a customer.
+func (s *CustomerService) PatchCustomer(ctx context.Context, id int, cust SaveCustomer) error {
+	return s.updateCustomer(ctx, id, cust, func(ctx context.Context, c SaveCustomer) (map[string]interface{}, error) {
+		return c.toMap(), nil
+	}, false)
+}
+
+// DeleteCustomer deletes a customer.
+func (s *CustomerService) DeleteCustomer(ctx context.Context, id int) error {
+	resp, err := s.customerManager.DeleteCustomerBulk(ctx, []map[string]interface{}{{"customerID": id}}, map[string]string{})
+	if err := customerError(err, deleteStatuses(resp)); err != nil {
+		if err == errCustomerNotFound {
+			s.invalidate(ctx, customerChange{id: id, deleted: true})
+		}
+		return err
+	}
+	s.invalidate(ctx, customerChange{id: id, deleted: true})
+	return nil
+}
+
+// updateCustomer validates the customer with the given ID and saves the input
+// that toMap builds for it. requireName is set for a full replace, where the
+// customer must keep a name.
+func (s *CustomerService) updateCustomer(ctx context.Context, id int, cust SaveCustomer, toMap func(context.Context, SaveCustomer) (map[string]interface{}, error), requireName bool) error {
+	if cust.CustomerID != nil && *cust.CustomerID != id {
+		return erplyerr.Validation("customerID in body does not match the URL", "customerID")
+	}
+	cust.CustomerID = &id
+	if violations := validateCustomer(0, cust, requireName); len(violations) > 0 {
+		return erplyerr.Invalid(violations)
+	}
+
+	input, err := toMap(ctx, cust)
+	if err != nil {
+		return err
+	}
+	if _, err := s.saveCustomer(ctx, input); err != nil {
+		return err
+	}
+	s.invalidate(ctx, customerChange{id: id, input: input})
+	return nil
+}
+
+// saveCustomer saves a single customer and returns its ID.
+func (s *CustomerService) saveCustomer(ctx context.Context, input map[string]interface{}) (int, error) {
+	resp, err := s.customerManager.SaveCustomerBulk(ctx, []map[string]interface{}{input}, map[string]string{})
+	if err := customerError(err, saveStatuses(resp)); err != nil {
+		return 0, err
+	}
+	if len(resp.BulkItems) == 0 || len(resp.BulkItems[0].Records) == 0 {
+		return 0, erplyerr.Internal("empty response from Erply", nil)
+	}
+	return resp.BulkItems[0].Records[0].CustomerID, nil
+}
+
+// customerError classifies the error of a single-customer Erply call and
+// replaces the generic not-found error with errCustomerNotFound.
+func customerError(err error, statuses []sharedCommon.StatusBulk) error {
+	e := erplyerr.FromBulk(err, statuses...)
+	if e == nil {
+		return nil
+	}
+	if e.Kind == erplyerr.KindNotFound {
+		return errCustomerNotFound
+	}
+	return e
+}
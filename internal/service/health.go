@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/quota"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/erply/api-go-wrapper/pkg/api/auth"
+)
+
+const (
+	DependencyUp       = "up"
+	DependencyDegraded = "degraded"
+	DependencyDown     = "down"
+
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+
+	// dependencyCheckTimeout bounds one dependency check, so a hanging
+	// dependency does not hang the readiness probe.
+	dependencyCheckTimeout = 3 * time.Second
+)
+
+// Dependency is something the service talks to, checked by the readiness
+// probe.
+type Dependency struct {
+	Name string
+	// Required dependencies make the service not ready while they are down.
+	Required bool
+	Check    func(ctx context.Context) error
+	// CacheFor reuses a result for that long, for checks that cost Erply
+	// requests. 0 checks on every probe.
+	CacheFor time.Duration
+}
+
+type DependencyStatus struct {
+	Status    string    `json:"status" enums:"up,degraded,down"`
+	Required  bool      `json:"required"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// degradedError is a check error that leaves the dependency usable in part.
+type degradedError struct{ error }
+
+func (e degradedError) Unwrap() error { return e.error }
+
+// Degraded marks a check error as leaving the dependency usable in part. The
+// dependency is then reported degraded, which does not make the service not
+// ready.
+func Degraded(err error) error {
+	return degradedError{err}
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+type Readiness struct {
+	Status       string                      `json:"status" enums:"ready,not_ready"`
+	Build        BuildInfo                   `json:"build"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+	// ErplyQuota is the Erply request quota of the current hour, when it is
+	// tracked. It does not affect the status.
+	ErplyQuota *quota.Status `json:"erplyQuota,omitempty"`
+}
+
+type HealthService struct {
+	build BuildInfo
+	deps  []*dependency
+}
+
+type dependency struct {
+	Dependency
+	mu   sync.Mutex
+	last *DependencyStatus
+}
+
+func NewHealthService(build BuildInfo, deps ...Dependency) *HealthService {
+	s := &HealthService{build: build}
+	for _, d := range deps {
+		s.deps = append(s.deps, &dependency{Dependency: d})
+	}
+	return s
+}
+
+func (s *HealthService) Build() BuildInfo {
+	return s.build
+}
+
+// Ready checks all dependencies concurrently. The service is ready when no
+// required dependency is down.
+func (s *HealthService) Ready(ctx context.Context) Readiness {
+	statuses := make([]DependencyStatus, len(s.deps))
+	var wg sync.WaitGroup
+	for i, d := range s.deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = d.status(ctx)
+		}()
+	}
+	wg.Wait()
+
+	ready := Readiness{Status: StatusReady, Build: s.build, Dependencies: map[string]DependencyStatus{}}
+	for i, d := range s.deps {
+		ready.Dependencies[d.Name] = statuses[i]
+		if d.Required && statuses[i].Status == DependencyDown {
+			ready.Status = StatusNotReady
+		}
+	}
+	return ready
+}
+
+// status runs the check, or returns the last result while it is within
+// CacheFor. Concurrent probes wait for one check instead of each running it.
+func (d *dependency) status(ctx context.Context) DependencyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.last != nil && time.Since(d.last.CheckedAt) < d.CacheFor {
+		return *d.last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := d.Check(ctx)
+	status := DependencyStatus{
+		Status:    DependencyUp,
+		Required:  d.Required,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		status.Status = DependencyDown
+		if errors.As(err, new(degradedError)) {
+			status.Status = DependencyDegraded
+		}
+		status.Error = err.Error()
+	}
+	// A probe that gave up says nothing about the dependency.
+	if ctx.Err() == nil || err == nil {
+		d.last = &status
+	}
+	return status
+}
+
+// ErplySessionCheck checks that Erply answers and that the session key from
+// session is still valid. It costs one Erply request, so give its Dependency
+// a CacheFor. Erply refusing the check for the hourly request limit leaves it
+// degraded, as cached customers are still served.
+func ErplySessionCheck(session func() (string, error), clientCode string, client *http.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sessionKey, err := session()
+		if err != nil {
+			return fmt.Errorf("no Erply session: %w", err)
+		}
+		info, err := auth.GetSessionKeyInfo(sessionKey, clientCode, contextClient{ctx: ctx, client: client})
+		if erplyerr.Is(err, erplyerr.KindQuotaExhausted) {
+			return Degraded(err)
+		}
+		if err != nil {
+			return err
+		}
+		expires, err := strconv.ParseInt(info.ExpireUnixTime, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Erply session expiry %q", info.ExpireUnixTime)
+		}
+		if time.Unix(expires, 0).Before(time.Now()) {
+			return fmt.Errorf("Erply session expired at %s", time.Unix(expires, 0).UTC().Format(time.RFC3339))
+		}
+		return nil
+	}
+}
+
+// contextClient sends requests with ctx, for SDK calls that take none.
+type contextClient struct {
+	ctx    context.Context
+	client *http.Client
+}
+
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
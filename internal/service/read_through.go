@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	cache "erply_test/internal/repository"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	// fillLockTTL bounds how long a crashed replica can keep others waiting.
+	fillLockTTL = 10 * time.Second
+	// fillWait is how long a read waits for another replica to fill a key
+	// before it fetches the key itself.
+	fillWait     = 2 * time.Second
+	fillPoll     = 50 * time.Millisecond
+	refreshLimit = 30 * time.Second
+	// sharedFetchLimit bounds a fetch shared by concurrent reads, which runs
+	// detached from the request of the read that started it.
+	sharedFetchLimit = 30 * time.Second
+)
+
+// CachePolicy controls the caching of one kind of read. A TTL of zero or
+// less disables caching, like Enabled false.
+type CachePolicy struct {
+	Enabled bool
+	// TTL is how long a cached value is fresh.
+	TTL time.Duration
+}
+
+func (p CachePolicy) caches() bool {
+	return p.Enabled && p.TTL > 0
+}
+
+// ReadOptions are the cache directives of a single read, taken from the
+// client's Cache-Control header.
+type ReadOptions struct {
+	// NoCache skips cached values and fetches from Erply. The result is
+	// still cached.
+	NoCache bool
+	// MaxAge, when set, replaces the policy TTL as the oldest cached value
+	// the read accepts. Values are kept at most TTL plus the
+	// stale-while-revalidate window, so older data is never available.
+	MaxAge *time.Duration
+}
+
+// cachedValue is a value cached by readThrough.
+type cachedValue interface {
+	fetchedTime() time.Time
+}
+
+func (p CustomerPage) fetchedTime() time.Time  { return p.FetchedAt }
+func (e CustomerEntry) fetchedTime() time.Time { return e.FetchedAt }
+
+// fetchFunc loads a value from Erply and returns the tags to cache it under.
+type fetchFunc[T cachedValue] func(ctx context.Context) (T, []string, error)
+
+// read is one read of a cache key.
+type read[T cachedValue] struct {
+	s      *CustomerService
+	values *cache.Typed[T]
+	key    string
+	policy CachePolicy
+	opts   ReadOptions
+	start  time.Time
+	fetch  fetchFunc[T]
+}
+
+// readThrough returns the value cached under key, or fetches and caches it.
+//
+// Concurrent misses for a key in this process share one fetch, and a lock in
+// the cache lets only one replica fetch at a time; the others wait for it to
+// fill the key. Within the stale-while-revalidate window an expired value is
+// returned as SourceStale while it is refreshed in the background.
+func readThrough[T cachedValue](ctx context.Context, s *CustomerService, values *cache.Typed[T], key string, policy CachePolicy, opts ReadOptions, fetch fetchFunc[T]) (T, string, error) {
+	if !policy.caches() {
+		val, _, err := fetch(ctx)
+		if err != nil {
+			return val, "", err
+		}
+		return val, SourceUpstream, nil
+	}
+
+	r := &read[T]{s: s, values: values, key: key, policy: policy, opts: opts, start: time.Now(), fetch: fetch}
+	if !opts.NoCache {
+		val, ok := r.cached(ctx)
+		switch {
+		case ok && r.accepts(val):
+			return val, SourceCache, nil
+		case ok && r.servesStale():
+			go r.refresh()
+			return val, SourceStale, nil
+		}
+	}
+
+	// The fetch outlives a caller that goes away, so the others still get
+	// its result; each caller stops waiting when its own ctx is done.
+	ch := s.flight.DoChan(r.flightKey(), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedFetchLimit)
+		defer cancel()
+		val, source, err := r.fill(ctx, false)
+		return sourced[T]{val, source}, err
+	})
+	var zero T
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, "", res.Err
+		}
+		out := res.Val.(sourced[T])
+		return out.val, out.source, nil
+	case <-ctx.Done():
+		return zero, "", ctx.Err()
+	}
+}
+
+type sourced[T any] struct {
+	val    T
+	source string
+}
+
+// accepts reports whether a cached val satisfies the read.
+func (r *read[T]) accepts(val T) bool {
+	switch {
+	case r.opts.NoCache:
+		// Only a value another read fetched after this one started.
+		return !val.fetchedTime().Before(r.start)
+	case r.opts.MaxAge != nil:
+		return time.Since(val.fetchedTime()) <= *r.opts.MaxAge
+	default:
+		// Without a stale-while-revalidate window values expire with the
+		// key, so every cached value is fresh.
+		return r.s.staleTTL == 0 || time.Since(val.fetchedTime()) < r.policy.TTL
+	}
+}
+
+// servesStale reports whether a value that is not accepted may be served
+// while it is refreshed. Cached values are never older than the
+// stale-while-revalidate window; reads with their own directives do not get
+// stale values.
+func (r *read[T]) servesStale() bool {
+	return r.s.staleTTL > 0 && !r.opts.NoCache && r.opts.MaxAge == nil
+}
+
+// flightKey coalesces only reads with the same directives.
+func (r *read[T]) flightKey() string {
+	switch {
+	case r.opts.NoCache:
+		return r.key + "#no-cache"
+	case r.opts.MaxAge != nil:
+		return r.key + "#max-age=" + strconv.FormatInt(int64(*r.opts.MaxAge), 10)
+	default:
+		return r.key
+	}
+}
+
+// fill fetches the key under the fill lock. Without the lock a refresh gives
+// up, while a read waits for the holder and fetches by itself if that takes
+// too long.
+func (r *read[T]) fill(ctx context.Context, refresh bool) (T, string, error) {
+	s := r.s
+	lockKey := "lock:" + r.key
+	token := newLockToken()
+	locked, err := s.cache.TryLock(ctx, lockKey, token, fillLockTTL)
+	if err != nil {
+		s.logger.Warn("error taking cache fill lock", "key", r.key, "error", err)
+	}
+	switch {
+	case locked:
+		defer func() {
+			if err := s.cache.Unlock(context.WithoutCancel(ctx), lockKey, token); err != nil {
+				s.logger.Warn("error releasing cache fill lock", "key", r.key, "error", err)
+			}
+		}()
+		// The holder before us may have just filled the key.
+		if val, ok := r.cached(ctx); ok && r.accepts(val) {
+			return val, SourceCache, nil
+		}
+	case refresh:
+		var zero T
+		return zero, "", nil
+	case err == nil:
+		if val, ok := r.waitForFill(ctx); ok {
+			return val, SourceCache, nil
+		}
+	}
+
+	gen := s.generations.current()
+	val, tags, err := r.fetch(ctx)
+	if err != nil {
+		return val, "", err
+	}
+	r.store(ctx, val, tags, gen)
+	return val, SourceUpstream, nil
+}
+
+// refresh refetches a stale key once, however many reads saw it stale.
+func (r *read[T]) refresh() {
+	s := r.s
+	if _, busy := s.refreshing.LoadOrStore(r.key, struct{}{}); busy {
+		return
+	}
+	defer s.refreshing.Delete(r.key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), refreshLimit)
+	defer cancel()
+	if _, _, err := r.fill(ctx, true); err != nil {
+		s.logger.Warn("error refreshing stale cache entry", "key", r.key, "error", err)
+	}
+}
+
+// waitForFill polls the key until another replica fills it, ctx is done or
+// fillWait has passed.
+func (r *read[T]) waitForFill(ctx context.Context) (T, bool) {
+	ticker := time.NewTicker(fillPoll)
+	defer ticker.Stop()
+	deadline := time.After(fillWait)
+	for {
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, false
+		case <-deadline:
+			var zero T
+			return zero, false
+		case <-ticker.C:
+			if val, ok := r.cached(ctx); ok && r.accepts(val) {
+				return val, true
+			}
+		}
+	}
+}
+
+// cached reads the key. The cache is a soft dependency: a value that does not
+// decode or a failing cache counts as a miss.
+func (r *read[T]) cached(ctx context.Context) (T, bool) {
+	val, ok, err := r.values.Get(ctx, r.key)
+	switch {
+	case errors.Is(err, cache.ErrCorrupt):
+		r.s.logger.Warn("dropping malformed cache entry", "key", r.key, "error", err)
+		return val, false
+	case err != nil:
+		r.s.logger.Warn("error reading cache, fetching from Erply", "key", r.key, "error", err)
+		return val, false
+	}
+	return val, ok
+}
+
+// store caches val long enough to serve it stale after the policy TTL,
+// unless a write invalidated the key or one of its tags since generation gen,
+// when val was fetched. A write that lands while val is stored drops it again.
+func (r *read[T]) store(ctx context.Context, val T, tags []string, gen uint64) {
+	names := append([]string{r.key}, tags...)
+	if r.s.generations.changedSince(gen, names...) {
+		r.s.logger.Debug("not caching entry changed while it was fetched", "key", r.key)
+		return
+	}
+	if err := r.values.Set(ctx, r.key, val, r.policy.TTL+r.s.staleTTL, tags...); err != nil {
+		r.s.logger.Error("error caching entry", "key", r.key, "error", err)
+		return
+	}
+	if r.s.generations.changedSince(gen, names...) {
+		if err := r.s.cache.Delete(ctx, r.key); err != nil {
+			r.s.logger.Error("error deleting cache entry changed while it was stored", "key", r.key, "error", err)
+		}
+	}
+}
+
+func newLockToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"erply_test/internal/erplyerr"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var phoneRe = regexp.MustCompile(`^\+?[0-9][0-9 ()\-.]{4,29}$`)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// Report fields by their JSON names.
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	_ = v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phoneRe.MatchString(fl.Field().String())
+	})
+	return v
+}
+
+// validateCustomers checks every customer of a bulk save. New customers
+// (without customerID) must have a name.
+func validateCustomers(customers []SaveCustomer) []erplyerr.Violation {
+	var violations []erplyerr.Violation
+	for i, cust := range customers {
+		violations = append(violations, validateCustomer(i, cust, cust.CustomerID == nil)...)
+	}
+	return violations
+}
+
+// validateCustomer checks one customer. requireName is set when the input
+// replaces all fields of a customer, on create and on full replace.
+func validateCustomer(index int, cust SaveCustomer, requireName bool) []erplyerr.Violation {
+	var violations []erplyerr.Violation
+	if requireName && cust.CompanyName == "" && cust.FirstName == "" && cust.LastName == "" {
+		violations = append(violations, erplyerr.Violation{
+			Index:   index,
+			Field:   "companyName",
+			Rule:    "person_or_company_name",
+			Message: "either companyName or firstName/lastName is required",
+		})
+	}
+
+	err := validate.Struct(cust)
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return violations
+	}
+	for _, fe := range fieldErrs {
+		violations = append(violations, erplyerr.Violation{
+			Index:   index,
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: violationMessage(fe),
+		})
+	}
+	return violations
+}
+
+// fieldPath returns the JSON path of the field without the struct name,
+// for example "attributes[0].name".
+func fieldPath(fe validator.FieldError) string {
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	return path
+}
+
+func violationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		return "must be a valid phone number"
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "min":
+		return "must be at least " + fe.Param()
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "datetime":
+		return "must be a date in YYYY-MM-DD format"
+	default:
+		return "is invalid (" + fe.Tag() + ")"
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"erply_test/internal/auth"
+	"erply_test/internal/logger"
+	"erply_test/internal/middleware"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keyFileEntry(name, secret, extra string) string {
+	return fmt.Sprintf(`{"name":%q,"hash":%q,"scopes":["customers:read"]%s}`, name, auth.HashKey(secret), extra)
+}
+
+func writeKeyFile(t *testing.T, path string, entries ...string) {
+	data := `{"keys":[`
+	for i, entry := range entries {
+		if i > 0 {
+			data += ","
+		}
+		data += entry
+	}
+	require.NoError(t, os.WriteFile(path, []byte(data+"]}"), 0o600))
+}
+
+func TestKeyStoreAuthenticate(t *testing.T) {
+	now := time.Now()
+	rfc := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path,
+		keyFileEntry("reader", "r-secret", ""),
+		keyFileEntry("off", "off-secret", `,"enabled":false`),
+		keyFileEntry("old", "old-secret", fmt.Sprintf(`,"expiresAt":%q`, rfc(now.Add(-time.Minute)))),
+		keyFileEntry("next", "next-secret", fmt.Sprintf(`,"notBefore":%q`, rfc(now.Add(time.Hour)))),
+	)
+	keys, err := auth.NewKeyStore(auth.FileKeys(path), logger.NewSlogLogger(), 0)
+	require.NoError(t, err)
+
+	principal, err := keys.Authenticate("r-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "apikey:reader", principal.ID)
+	assert.True(t, principal.HasScope(auth.ScopeCustomersRead))
+	assert.False(t, principal.HasScope(auth.ScopeCustomersWrite))
+
+	for secret, want := range map[string]error{
+		"unknown":     auth.ErrUnknownKey,
+		"off-secret":  auth.ErrKeyDisabled,
+		"old-secret":  auth.ErrKeyExpired,
+		"next-secret": auth.ErrKeyNotYetValid,
+	} {
+		_, err := keys.Authenticate(secret)
+		assert.ErrorIs(t, err, want, secret)
+	}
+}
+
+func TestKeyStoreRotationOverlap(t *testing.T) {
+	now := time.Now()
+	oldKey := auth.NewAPIKey("billing", "v1", auth.ScopeCustomersRead)
+	oldKey.ExpiresAt = now.Add(time.Hour)
+	newKey := auth.NewAPIKey("billing", "v2", auth.ScopeCustomersRead)
+	newKey.NotBefore = now.Add(-time.Hour)
+	keys := newKeyStore(t, oldKey, newKey)
+
+	for _, secret := range []string{"v1", "v2"} {
+		principal, err := keys.Authenticate(secret)
+		require.NoError(t, err, secret)
+		assert.Equal(t, "apikey:billing", principal.ID)
+	}
+}
+
+func TestKeyStoreReloadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, keyFileEntry("a", "a-secret", ""))
+	keys, err := auth.NewKeyStore(auth.FileKeys(path), logger.NewSlogLogger(), 10*time.Millisecond)
+	require.NoError(t, err)
+	defer keys.Close()
+
+	writeKeyFile(t, path, keyFileEntry("b", "b-secret", ""))
+	assert.Eventually(t, func() bool {
+		_, err := keys.Authenticate("b-secret")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = keys.Authenticate("a-secret")
+	assert.ErrorIs(t, err, auth.ErrUnknownKey)
+
+	// A broken file keeps the current keys.
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	require.Error(t, keys.Reload(context.Background()))
+	_, err = keys.Authenticate("b-secret")
+	assert.NoError(t, err)
+}
+
+func TestStartKeyStoreFallsBack(t *testing.T) {
+	// The key file stands in for Redis being down at startup.
+	path := filepath.Join(t.TempDir(), "keys.json")
+	static := auth.StaticKeys{auth.NewAPIKey("default", "d-secret", auth.AllScopes...)}
+	keys, err := auth.StartKeyStore(auth.KeySources{static, auth.FileKeys(path)}, static, logger.NewSlogLogger(), 10*time.Millisecond)
+	require.NoError(t, err)
+	defer keys.Close()
+
+	assert.Error(t, keys.Ready(context.Background()))
+	_, err = keys.Authenticate("d-secret")
+	assert.NoError(t, err)
+
+	writeKeyFile(t, path, keyFileEntry("b", "b-secret", ""))
+	assert.Eventually(t, func() bool { return keys.Ready(context.Background()) == nil }, time.Second, 10*time.Millisecond)
+	for _, secret := range []string{"d-secret", "b-secret"} {
+		_, err = keys.Authenticate(secret)
+		assert.NoError(t, err, secret)
+	}
+
+	_, err = auth.StartKeyStore(auth.FileKeys(path+".missing"), auth.FileKeys(path+".missing"), logger.NewSlogLogger(), 0)
+	assert.Error(t, err)
+}
+
+func TestParseAPIKeysInvalid(t *testing.T) {
+	for name, entry := range map[string]string{
+		"no name":       fmt.Sprintf(`{"hash":%q}`, auth.HashKey("x")),
+		"plain secret":  `{"name":"a","hash":"secret"}`,
+		"unknown scope": fmt.Sprintf(`{"name":"a","hash":%q,"scopes":["customers:all"]}`, auth.HashKey("x")),
+	} {
+		_, err := auth.ParseAPIKeys([]byte(`{"keys":[` + entry + `]}`))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAuthorizeScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reader := auth.NewAPIKey("reader", "r-secret", auth.ScopeCustomersRead)
+	reader.Role = auth.RoleAdmin
+	keys := newKeyStore(t, reader)
+	router := gin.New()
+	router.Use(middleware.APIKeyAuthMiddleware(keys))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/customers", middleware.Authorize(logger.NewSlogLogger(), auth.ScopeCustomersRead, auth.RoleReadOnly), ok)
+	router.DELETE("/customers/:id", middleware.Authorize(logger.NewSlogLogger(), auth.ScopeCustomersDelete, auth.RoleAdmin), ok)
+
+	for method, want := range map[string]int{http.MethodGet: http.StatusOK, http.MethodDelete: http.StatusForbidden} {
+		path := "/customers"
+		if method == http.MethodDelete {
+			path = "/customers/1"
+		}
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("X-API-KEY", "r-secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, method)
+	}
+}
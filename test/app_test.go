@@ -0,0 +1,33 @@
+package test
+
+import (
+	"erply_test/internal/app"
+	"net/http"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/erply/api-go-wrapper/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig(t *testing.T, vars map[string]string) *app.Config {
+	var cfg app.Config
+	require.NoError(t, env.ParseWithOptions(&cfg, env.Options{Environment: vars}))
+	return &cfg
+}
+
+func TestNewAppWithoutRedis(t *testing.T) {
+	erplyClient, err := api.NewClient("session", "123456", http.DefaultClient)
+	require.NoError(t, err)
+
+	// The rate limiters and the quota default to Redis and count per
+	// instance when no Redis server is configured.
+	for _, driver := range []string{"memory", "none"} {
+		cfg := newTestConfig(t, map[string]string{"CACHE_DRIVER": driver, "API_KEY": "x"})
+		assert.NotPanics(t, func() { app.NewApp(cfg, erplyClient, http.DefaultClient).Shutdown() }, driver)
+	}
+
+	cfg := newTestConfig(t, map[string]string{"CACHE_DRIVER": "redis", "API_KEY": "x"})
+	assert.Panics(t, func() { app.NewApp(cfg, erplyClient, http.DefaultClient) })
+}
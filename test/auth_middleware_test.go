@@ -5,14 +5,24 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"erply_test/internal/auth"
+	"erply_test/internal/logger"
 	"erply_test/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func newKeyStore(t *testing.T, keys ...auth.APIKey) *auth.KeyStore {
+	store, err := auth.NewKeyStore(auth.StaticKeys(keys), logger.NewSlogLogger(), 0)
+	require.NoError(t, err)
+	return store
+}
+
 func TestAPIKeyAuthMiddleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
+	keys := newKeyStore(t, auth.NewAPIKey("test", "valid_key", auth.AllScopes...))
 
 	tests := []struct {
 		name           string
@@ -43,7 +53,7 @@ func TestAPIKeyAuthMiddleware(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			router := gin.New()
-			router.Use(middleware.APIKeyAuthMiddleware("valid_key"))
+			router.Use(middleware.APIKeyAuthMiddleware(keys))
 			router.GET("/test", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "success"})
 			})
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"erply_test/internal/api"
+	"erply_test/internal/logger"
+	cache "erply_test/internal/repository"
+	"erply_test/internal/service"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errCacheDown = errors.New("connection refused")
+
+// flakyCache is a MemoryCache that fails every call while down is set, like
+// a Redis that went away.
+type flakyCache struct {
+	*cache.MemoryCache
+	down atomic.Bool
+}
+
+func newFlakyCache(t *testing.T) *flakyCache {
+	return &flakyCache{MemoryCache: newMemoryCache(t)}
+}
+
+func (f *flakyCache) err() error {
+	if f.down.Load() {
+		return errCacheDown
+	}
+	return nil
+}
+
+func (f *flakyCache) Ping(ctx context.Context) error { return f.err() }
+
+func (f *flakyCache) Get(ctx context.Context, key string) (string, error) {
+	if err := f.err(); err != nil {
+		return "", err
+	}
+	return f.MemoryCache.Get(ctx, key)
+}
+
+func (f *flakyCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	return f.MemoryCache.Set(ctx, key, value, ttl)
+}
+
+func (f *flakyCache) SetWithTags(ctx context.Context, key, value string, ttl time.Duration, tags ...string) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	return f.MemoryCache.SetWithTags(ctx, key, value, ttl, tags...)
+}
+
+func (f *flakyCache) Delete(ctx context.Context, keys ...string) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	return f.MemoryCache.Delete(ctx, keys...)
+}
+
+func (f *flakyCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	return f.MemoryCache.InvalidateTags(ctx, tags...)
+}
+
+func newTestBreaker(t *testing.T, inner cache.PingableCache) *cache.BreakerCache {
+	b := cache.NewBreakerCache(inner, logger.NewSlogLogger(), 3, 20*time.Millisecond)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyCache(t)
+	b := newTestBreaker(t, inner)
+	require.True(t, b.Healthy())
+
+	inner.down.Store(true)
+	for i := 0; i < 3; i++ {
+		_, err := b.Get(ctx, "k")
+		assert.ErrorIs(t, err, errCacheDown)
+	}
+	assert.False(t, b.Healthy())
+
+	// Open: a miss, not an error.
+	val, err := b.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "", val)
+	assert.NoError(t, b.Set(ctx, "k", "v", time.Minute))
+	ok, err := b.TryLock(ctx, "lock:k", "a", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestBreakerStartsDegradedAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyCache(t)
+	inner.down.Store(true)
+	b := newTestBreaker(t, inner)
+	assert.False(t, b.Healthy())
+
+	inner.down.Store(false)
+	assert.Eventually(t, b.Healthy, time.Second, 10*time.Millisecond)
+	require.NoError(t, b.Set(ctx, "k", "v", time.Minute))
+	val, _ := b.Get(ctx, "k")
+	assert.Equal(t, "v", val)
+}
+
+func TestBreakerReplaysInvalidationsOnRecovery(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyCache(t)
+	b := newTestBreaker(t, inner)
+	require.NoError(t, b.Set(ctx, "customer:7", "old", time.Minute))
+	require.NoError(t, b.SetWithTags(ctx, "page", "old", time.Minute, "customer:7"))
+
+	inner.down.Store(true)
+	for i := 0; i < 3; i++ {
+		_, _ = b.Get(ctx, "k")
+	}
+	require.False(t, b.Healthy())
+	assert.NoError(t, b.Delete(ctx, "customer:7"))
+	assert.NoError(t, b.InvalidateTags(ctx, "customer:7"))
+
+	inner.down.Store(false)
+	assert.Eventually(t, b.Healthy, time.Second, 10*time.Millisecond)
+	for _, key := range []string{"customer:7", "page"} {
+		val, err := b.Get(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, "", val, key)
+	}
+}
+
+func TestGetCustomersCacheErrorFallsBackToErply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.New()
+	r.GET("/api/customers", handler.GetCustomers)
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return("", errCacheDown)
+	mockCache.On("SetWithTags", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errCacheDown)
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+}
+
+func TestHealthReportsDegradedCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	inner := newFlakyCache(t)
+	inner.down.Store(true)
+	log := logger.NewSlogLogger()
+	r := gin.New()
+	handler := api.NewHandler(r, log, service.NewCustomerService(new(MockCustomerManager), newTestBreaker(t, inner), log))
+	r.GET("/health", handler.GetHealth)
+
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]string{"status": "degraded", "cache": "down"}, body)
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"context"
+	cache "erply_test/internal/repository"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCacheConformance checks the behaviour every CacheInterface
+// implementation must share. Keys are prefixed, so the suite can run against
+// a shared Redis.
+func testCacheConformance(t *testing.T, newCache func(t *testing.T) cache.CacheInterface) {
+	ctx := context.Background()
+	prefix := fmt.Sprintf("conformance:%d:", time.Now().UnixNano())
+	key := func(name string) string { return prefix + name }
+
+	t.Run("GetMissing", func(t *testing.T) {
+		c := newCache(t)
+		val, err := c.Get(ctx, key("missing"))
+		assert.NoError(t, err)
+		assert.Equal(t, "", val)
+	})
+
+	t.Run("SetGetOverwrite", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.Set(ctx, key("a"), "1", time.Minute))
+		require.NoError(t, c.Set(ctx, key("a"), "2", time.Minute))
+		val, err := c.Get(ctx, key("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, "2", val)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.Set(ctx, key("short"), "1", 50*time.Millisecond))
+		require.NoError(t, c.Set(ctx, key("forever"), "1", 0))
+		time.Sleep(100 * time.Millisecond)
+
+		val, err := c.Get(ctx, key("short"))
+		assert.NoError(t, err)
+		assert.Equal(t, "", val)
+		val, err = c.Get(ctx, key("forever"))
+		assert.NoError(t, err)
+		assert.Equal(t, "1", val)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.Set(ctx, key("d1"), "1", time.Minute))
+		require.NoError(t, c.Set(ctx, key("d2"), "1", time.Minute))
+		require.NoError(t, c.Set(ctx, key("d3"), "1", time.Minute))
+		assert.NoError(t, c.Delete(ctx, key("d1"), key("d2"), key("never-set")))
+
+		for name, want := range map[string]string{"d1": "", "d2": "", "d3": "1"} {
+			val, err := c.Get(ctx, key(name))
+			assert.NoError(t, err)
+			assert.Equal(t, want, val, name)
+		}
+	})
+
+	t.Run("InvalidateTags", func(t *testing.T) {
+		c := newCache(t)
+		tagA, tagB, tagC := key("tag-a"), key("tag-b"), key("tag-c")
+		require.NoError(t, c.SetWithTags(ctx, key("t1"), "1", time.Minute, tagA))
+		require.NoError(t, c.SetWithTags(ctx, key("t2"), "1", time.Minute, tagA, tagB))
+		require.NoError(t, c.SetWithTags(ctx, key("t3"), "1", time.Minute, tagB))
+		require.NoError(t, c.SetWithTags(ctx, key("t4"), "1", time.Minute, tagC))
+		require.NoError(t, c.Set(ctx, key("t5"), "1", time.Minute))
+
+		assert.NoError(t, c.InvalidateTags(ctx, tagA, key("tag-unknown")))
+
+		for name, want := range map[string]string{"t1": "", "t2": "", "t3": "1", "t4": "1", "t5": "1"} {
+			val, err := c.Get(ctx, key(name))
+			assert.NoError(t, err)
+			assert.Equal(t, want, val, name)
+		}
+
+		// A tag can be reused after it was invalidated.
+		require.NoError(t, c.SetWithTags(ctx, key("t1"), "2", time.Minute, tagA))
+		assert.NoError(t, c.InvalidateTags(ctx, tagA))
+		val, err := c.Get(ctx, key("t1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "", val)
+	})
+
+	t.Run("InvalidateNothing", func(t *testing.T) {
+		c := newCache(t)
+		assert.NoError(t, c.InvalidateTags(ctx))
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		c := newCache(t)
+		ok, err := c.TryLock(ctx, key("lock"), "a", time.Minute)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = c.TryLock(ctx, key("lock"), "b", time.Minute)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// Only the holder can unlock.
+		require.NoError(t, c.Unlock(ctx, key("lock"), "b"))
+		ok, _ = c.TryLock(ctx, key("lock"), "b", time.Minute)
+		assert.False(t, ok)
+
+		require.NoError(t, c.Unlock(ctx, key("lock"), "a"))
+		ok, _ = c.TryLock(ctx, key("lock"), "b", time.Minute)
+		assert.True(t, ok)
+	})
+
+	t.Run("LockExpiry", func(t *testing.T) {
+		c := newCache(t)
+		ok, _ := c.TryLock(ctx, key("lock"), "a", 50*time.Millisecond)
+		require.True(t, ok)
+		time.Sleep(100 * time.Millisecond)
+		ok, err := c.TryLock(ctx, key("lock"), "b", time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestMemoryCacheConformance(t *testing.T) {
+	testCacheConformance(t, func(t *testing.T) cache.CacheInterface {
+		c := cache.NewMemoryCache(100, time.Minute)
+		t.Cleanup(func() { c.Close() })
+		return c
+	})
+}
+
+// TestRedisCacheConformance runs against the Redis at TEST_REDIS_ADDR and is
+// skipped when it is not set.
+func TestRedisCacheConformance(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	testCacheConformance(t, func(t *testing.T) cache.CacheInterface {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		require.NoError(t, client.Ping(context.Background()).Err())
+		c := cache.NewRedisCache(client)
+		t.Cleanup(func() {
+			c.Close()
+			client.Close()
+		})
+		return c
+	})
+}
+
+// TestRedisClusterCacheConformance runs against the Redis Cluster seed nodes
+// in TEST_REDIS_CLUSTER_ADDR (comma-separated) and is skipped when it is not
+// set.
+func TestRedisClusterCacheConformance(t *testing.T) {
+	addrs := os.Getenv("TEST_REDIS_CLUSTER_ADDR")
+	if addrs == "" {
+		t.Skip("TEST_REDIS_CLUSTER_ADDR not set")
+	}
+	testCacheConformance(t, func(t *testing.T) cache.CacheInterface {
+		client, err := cache.NewRedisClient(cache.RedisConfig{Mode: cache.RedisModeCluster, Addrs: strings.Split(addrs, ",")})
+		require.NoError(t, err)
+		require.NoError(t, client.Ping(context.Background()).Err())
+		c := cache.NewRedisCache(client)
+		t.Cleanup(func() {
+			c.Close()
+			client.Close()
+		})
+		return c
+	})
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(2, time.Minute)
+	defer c.Close()
+
+	require.NoError(t, c.SetWithTags(ctx, "a", "1", time.Minute, "tag"))
+	require.NoError(t, c.Set(ctx, "b", "1", time.Minute))
+	_, _ = c.Get(ctx, "a")
+	require.NoError(t, c.Set(ctx, "c", "1", time.Minute))
+
+	assert.Equal(t, 2, c.Len())
+	for name, want := range map[string]string{"a": "1", "b": "", "c": "1"} {
+		val, _ := c.Get(ctx, name)
+		assert.Equal(t, want, val, name)
+	}
+}
+
+func TestMemoryCacheSweepsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(100, 10*time.Millisecond)
+	defer c.Close()
+
+	require.NoError(t, c.SetWithTags(ctx, "a", "1", 20*time.Millisecond, "tag"))
+	require.NoError(t, c.Set(ctx, "b", "1", 0))
+
+	assert.Eventually(t, func() bool { return c.Len() == 1 }, time.Second, 10*time.Millisecond)
+}
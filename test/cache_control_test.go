@@ -0,0 +1,120 @@
+package test
+
+import (
+	"encoding/json"
+	"erply_test/internal/api"
+	"erply_test/internal/logger"
+	cache "erply_test/internal/repository"
+	"erply_test/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newCachingRouter(mockManager *MockCustomerManager, c cache.CacheInterface, opts ...service.Option) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	log := logger.NewSlogLogger()
+	r := gin.New()
+	handler := api.NewHandler(r, log, service.NewCustomerService(mockManager, c, log, opts...))
+	r.GET("/api/customers", handler.GetCustomers)
+	r.GET("/api/customers/:id", handler.GetCustomer)
+	return r
+}
+
+func getWithCacheControl(r *gin.Engine, path, cacheControl string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	if cacheControl != "" {
+		req.Header.Set("Cache-Control", cacheControl)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetCustomerCacheHeaders(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	r := newCachingRouter(mockManager, c)
+
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+
+	w := getWithCacheControl(r, "/api/customers/7", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+
+	cacheCustomerEntry(t, c, service.Customer{ID: 7, FirstName: "Anna"}, time.Now().Add(-90*time.Second))
+	w = getWithCacheControl(r, "/api/customers/7", "")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "90", w.Header().Get("Age"))
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestGetCustomerNoCacheFetchesUpstream(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	r := newCachingRouter(mockManager, c)
+
+	cacheCustomerEntry(t, c, service.Customer{ID: 7, FirstName: "Anna"}, time.Now())
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Berta"}), nil)
+
+	w := getWithCacheControl(r, "/api/customers/7", "no-cache")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	var resp api.CustomerResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Berta", resp.Customer.FirstName)
+
+	// The fetched customer replaced the cached one.
+	w = getWithCacheControl(r, "/api/customers/7", "")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Berta", resp.Customer.FirstName)
+}
+
+func TestGetCustomerMaxAge(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	r := newCachingRouter(mockManager, c, service.WithCustomerCache(service.CachePolicy{Enabled: true, TTL: time.Minute}),
+		service.WithStaleWhileRevalidate(time.Hour))
+
+	cacheCustomerEntry(t, c, service.Customer{ID: 7, FirstName: "Anna"}, time.Now().Add(-5*time.Minute))
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Berta"}), nil)
+
+	// Older than the policy TTL, but the client accepts it.
+	w := getWithCacheControl(r, "/api/customers/7", "max-age=600")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "300", w.Header().Get("Age"))
+	mockManager.AssertNotCalled(t, "GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything)
+
+	w = getWithCacheControl(r, "/api/customers/7", "max-age=60")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestGetCustomersCacheDisabled(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCachingRouter(mockManager, newMemoryCache(t), service.WithListCache(service.CachePolicy{Enabled: false}))
+
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+
+	for i := 0; i < 2; i++ {
+		w := getWithCacheControl(r, "/api/customers", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		var resp api.CustomerListResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 0, resp.Meta.TTL)
+	}
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 2)
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"erply_test/internal/logger"
+	cache "erply_test/internal/repository"
+	"erply_test/internal/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	page := service.CustomerPage{
+		Customers: []service.Customer{{ID: 7, FirstName: "Anna", Notes: strings.Repeat("long notes ", 200)}},
+		Total:     1,
+		FetchedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	for _, tc := range []struct{ compression, prefix string }{
+		{cache.CompressionNone, "v3:n:"},
+		{cache.CompressionGzip, "v3:g:"},
+		{cache.CompressionZstd, "v3:z:"},
+	} {
+		t.Run(tc.compression, func(t *testing.T) {
+			codec, err := cache.NewCodec(tc.compression, 1024)
+			require.NoError(t, err)
+			data, err := codec.Encode(page, 3)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(data, tc.prefix))
+
+			var got service.CustomerPage
+			ok, err := codec.Decode(data, 3, &got)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, page, got)
+		})
+	}
+}
+
+func TestCodecSkipsCompressionOfSmallValues(t *testing.T) {
+	codec, err := cache.NewCodec(cache.CompressionZstd, 1024)
+	require.NoError(t, err)
+	data, err := codec.Encode(service.Customer{ID: 7}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, `v1:n:{"id":7}`, data)
+}
+
+func TestCodecReadsOtherCompression(t *testing.T) {
+	gzipCodec, _ := cache.NewCodec(cache.CompressionGzip, 0)
+	zstdCodec, _ := cache.NewCodec(cache.CompressionZstd, 0)
+
+	data, err := gzipCodec.Encode(service.Customer{ID: 7}, 1)
+	require.NoError(t, err)
+	var got service.Customer
+	ok, err := zstdCodec.Decode(data, 1, &got)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 7, got.ID)
+}
+
+func TestCodecVersionMismatchIsMiss(t *testing.T) {
+	codec, _ := cache.NewCodec(cache.CompressionNone, 0)
+	data, _ := codec.Encode(service.Customer{ID: 7}, 1)
+
+	var got service.Customer
+	ok, err := codec.Decode(data, 2, &got)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, service.Customer{}, got)
+}
+
+func TestCodecCorruptValues(t *testing.T) {
+	codec, _ := cache.NewCodec(cache.CompressionNone, 0)
+	for _, data := range []string{`{"id":7}`, "v1:n", "vx:n:{}", "v1:q:{}", "v1:g:not gzip", "v1:n:{"} {
+		var got service.Customer
+		ok, err := codec.Decode(data, 1, &got)
+		assert.ErrorIs(t, err, cache.ErrCorrupt, data)
+		assert.False(t, ok, data)
+	}
+}
+
+func TestNewCodecRejectsUnknownCompression(t *testing.T) {
+	_, err := cache.NewCodec("brotli", 0)
+	assert.Error(t, err)
+}
+
+func TestGetCustomerIgnoresOldSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	svc := service.NewCustomerService(mockManager, c, logger.NewSlogLogger())
+
+	codec, _ := cache.NewCodec(cache.CompressionNone, 0)
+	old, _ := codec.Encode(service.CustomerEntry{Customer: service.Customer{ID: 7, FirstName: "Anna"}, FetchedAt: time.Now()},
+		service.CacheSchemaVersion-1)
+	require.NoError(t, c.Set(ctx, "customer:7", old, time.Hour))
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Berta"}), nil)
+
+	entry, source, err := svc.GetCustomer(ctx, 7, service.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, service.SourceUpstream, source)
+	assert.Equal(t, "Berta", entry.Customer.FirstName)
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// exportPages builds a bulk response with one item per page size, numbering
+// the customers from firstID.
+func exportPages(total, firstID int, sizes ...int) customers.GetCustomersResponseBulk {
+	resp := customers.GetCustomersResponseBulk{Status: sharedCommon.Status{ResponseStatus: "ok"}}
+	id := firstID
+	for _, size := range sizes {
+		item := customers.GetCustomersResponseBulkItem{
+			Status: sharedCommon.StatusBulk{Status: sharedCommon.Status{ResponseStatus: "ok", RecordsTotal: total}},
+		}
+		for i := 0; i < size; i++ {
+			item.Customers = append(item.Customers, customers.Customer{ID: id})
+			id++
+		}
+		resp.BulkItems = append(resp.BulkItems, item)
+	}
+	return resp
+}
+
+func startingAt(pageNo int) interface{} {
+	return mock.MatchedBy(func(filters []map[string]interface{}) bool {
+		return len(filters) == 10 && filters[0]["pageNo"] == pageNo && filters[0]["recordsOnPage"] == 100
+	})
+}
+
+func readExport(t *testing.T, w *httptest.ResponseRecorder) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestExportCustomers(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+
+	full := []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(1), mock.Anything).
+		Return(exportPages(1050, 1, full...), nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(11), mock.Anything).
+		Return(exportPages(1050, 1001, 50, 0, 0, 0, 0, 0, 0, 0, 0, 0), nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/export", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "1050", w.Header().Get("X-Total-Count"))
+	lines := readExport(t, w)
+	assert.Len(t, lines, 1050)
+	for i, line := range lines {
+		assert.Equal(t, float64(i+1), line["id"])
+	}
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 2)
+}
+
+func TestExportCustomersStopsAtTotal(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+
+	full := []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(1), mock.Anything).
+		Return(exportPages(1000, 1, full...), nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/export?groupID=3", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, readExport(t, w), 1000)
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestExportCustomersFailsMidStream(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+
+	full := []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(1), mock.Anything).
+		Return(exportPages(5000, 1, full...), nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(11), mock.Anything).
+		Return(customers.GetCustomersResponseBulk{}, sharedCommon.NewErplyError("Error", "connection refused", 0))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/export", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := readExport(t, w)
+	assert.Len(t, lines, 1001)
+	last := lines[len(lines)-1]["error"].(map[string]interface{})
+	assert.Equal(t, "upstream_unavailable", last["code"])
+}
+
+func TestExportCustomersFailsBeforeStream(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(1), mock.Anything).
+		Return(customers.GetCustomersResponseBulk{}, sharedCommon.NewErplyError("Error", "connection refused", 0))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/export", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var body struct {
+		Code string `json:"code"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "upstream_unavailable", body.Code)
+}
+
+func TestExportCustomersClientDisconnect(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	full := []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(1), mock.Anything).
+		Run(func(mock.Arguments) { cancel() }).
+		Return(exportPages(5000, 1, full...), nil)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/api/customers/export", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Empty(t, w.Body.String())
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
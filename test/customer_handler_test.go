@@ -0,0 +1,348 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"erply_test/internal/api"
+	"erply_test/internal/middleware"
+	"erply_test/internal/service"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newCustomerRouter(mockManager *MockCustomerManager, mockCache *MockCache) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.Use(middleware.RequestIDMiddleware())
+	r.GET("/api/customers/export", handler.ExportCustomers)
+	r.POST("/api/customers", handler.CreateCustomer)
+	r.DELETE("/api/customers/delete", handler.DeleteCustomers)
+	r.POST("/api/customers/save", handler.SaveCustomers)
+	r.GET("/api/customers/:id", handler.GetCustomer)
+	r.PUT("/api/customers/:id", handler.ReplaceCustomer)
+	r.PATCH("/api/customers/:id", handler.PatchCustomer)
+	r.DELETE("/api/customers/:id", handler.DeleteCustomer)
+	return r
+}
+
+func getCustomerResponse(cs ...customers.Customer) customers.GetCustomersResponseBulk {
+	return customers.GetCustomersResponseBulk{
+		Status: sharedCommon.Status{ResponseStatus: "ok"},
+		BulkItems: []customers.GetCustomersResponseBulkItem{
+			{
+				Status:    sharedCommon.StatusBulk{Status: sharedCommon.Status{ResponseStatus: "ok", RecordsTotal: len(cs)}},
+				Customers: cs,
+			},
+		},
+	}
+}
+
+func notFoundStatus() sharedCommon.StatusBulk {
+	return sharedCommon.StatusBulk{Status: sharedCommon.Status{ResponseStatus: "error", ErrorCode: sharedCommon.InvalidClassifierID}}
+}
+
+func TestGetCustomer(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockCache.On("Get", mock.Anything, "customer:7").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, []map[string]interface{}{{"customerID": 7}}, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+	mockCache.On("Set", mock.Anything, "customer:7", mock.Anything, mock.Anything).Return(nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/7", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp api.CustomerResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, service.Customer{ID: 7, FirstName: "Anna"}, resp.Customer)
+	assert.Equal(t, "upstream", resp.Meta.Source)
+	mockManager.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestGetCustomerNotFound(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockCache.On("Get", mock.Anything, "customer:8").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(), nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/8", nil)
+	req.Header.Set("X-Request-ID", "req-8")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":"not_found","message":"customer not found","requestId":"req-8"}`, w.Body.String())
+	mockCache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetCustomerInvalidID(t *testing.T) {
+	r := newCustomerRouter(new(MockCustomerManager), new(MockCache))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateCustomer(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockManager.On("SaveCustomerBulk", mock.Anything, []map[string]interface{}{{"firstName": "Anna", "email": "anna@example.com"}}, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{{Records: []customers.SaveCustomerResp{{CustomerID: 55}}}},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:55"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("Get", mock.Anything, "customer:55").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 55, FirstName: "Anna", Email: "anna@example.com"}), nil)
+	mockCache.On("Set", mock.Anything, "customer:55", mock.Anything, mock.Anything).Return(nil)
+
+	body := []byte(`{"firstName": "Anna", "email": "anna@example.com"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/api/customers/55", w.Header().Get("Location"))
+	mockManager.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestReplaceCustomerSendsAllFields(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	current := customers.Customer{ID: 9, FirstName: "Anna", Attributes: []sharedCommon.ObjAttribute{
+		{AttributeName: "tier", AttributeType: "text", AttributeValue: "gold"},
+		{AttributeName: "region", AttributeType: "text", AttributeValue: "south"},
+	}}
+	expected := []map[string]interface{}{{
+		"customerID": 9, "firstName": "Anna", "lastName": "", "companyName": "", "email": "", "phone": "",
+		"mobile": "", "fax": "", "website": "", "address": "", "code": "", "vatNumber": "",
+		"birthday": "", "gender": "", "notes": "",
+		"groupID": 0, "paymentDays": 0, "credit": 0,
+		"taxExempt": 0, "emailEnabled": 0, "mailEnabled": 0, "emailOptOut": 0,
+		"attributeName1": "region", "attributeType1": "text", "attributeValue1": "north",
+		"attributeName2": "tier", "attributeType2": "text", "attributeValue2": "",
+	}}
+	mockManager.On("SaveCustomerBulk", mock.Anything, expected, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{{Records: []customers.SaveCustomerResp{{CustomerID: 9}}}},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:9"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, []string{"customer:9", "filter:changedSince", "filter:groupID=0", "filter:name"}).Return(nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("Get", mock.Anything, "customer:9").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(current), nil)
+
+	body := `{"firstName": "Anna", "attributes": [{"name": "region", "type": "text", "value": "north"}]}`
+	req, _ := http.NewRequest(http.MethodPut, "/api/customers/9", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockManager.AssertExpectations(t)
+}
+
+func TestReplaceCustomerNotFound(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).Return(getCustomerResponse(), nil)
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/customers/9", bytes.NewReader([]byte(`{"firstName": "Anna"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockManager.AssertNotCalled(t, "SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPatchCustomerNotFound(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockManager.On("SaveCustomerBulk", mock.Anything, []map[string]interface{}{{"customerID": 10, "phone": "+372 555"}}, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{{Status: notFoundStatus()}},
+		}, errors.New("ERPLY API: error, code: 1011"))
+
+	req, _ := http.NewRequest(http.MethodPatch, "/api/customers/10", bytes.NewReader([]byte(`{"phone": "+372 555"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockManager.AssertExpectations(t)
+}
+
+func TestDeleteCustomer(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockManager.On("DeleteCustomerBulk", mock.Anything, []map[string]interface{}{{"customerID": 11}}, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:11"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/11", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockManager.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestDeleteCustomerNotFound(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockManager.On("DeleteCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{
+			BulkItems: []customers.DeleteCustomerResponseBulkItem{{Status: notFoundStatus()}},
+		}, errors.New("ERPLY API: error, code: 1011"))
+	mockCache.On("Delete", mock.Anything, []string{"customer:12"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/12", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetCustomerUpstreamUnavailable(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockCache.On("Get", mock.Anything, "customer:13").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.GetCustomersResponseBulk{}, sharedCommon.NewFromError("getCustomers request failed", errors.New("dial tcp: connection refused"), 0))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/13", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	assert.Contains(t, w.Body.String(), `"code":"upstream_unavailable"`)
+}
+
+func TestPatchCustomerDoesNotRequireName(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/api/customers/10", bytes.NewReader([]byte(`{"phone": "abc"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"code":"validation_error","message":"request validation failed","requestId":`+
+		`"`+w.Header().Get("X-Request-ID")+`","violations":[`+
+		`{"index":0,"field":"phone","rule":"phone","message":"must be a valid phone number"}]}`, w.Body.String())
+	mockManager.AssertNotCalled(t, "SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateCustomerReadBackFails(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{{Records: []customers.SaveCustomerResp{{CustomerID: 55}}}},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:55"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("Get", mock.Anything, "customer:55").Return("", nil)
+	mockCache.On("TryLock", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Maybe()
+	mockCache.On("Unlock", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.GetCustomersResponseBulk{}, sharedCommon.NewErplyError("Error", "connection refused", 0))
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers", bytes.NewReader([]byte(`{"firstName": "Anna"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var resp api.CustomerResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 55, resp.Customer.ID)
+	assert.Contains(t, w.Body.String(), `"meta":{`)
+}
+
+func TestCreateCustomerRequiresName(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	r := newCustomerRouter(mockManager, new(MockCache))
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers", bytes.NewReader([]byte(`{"email": "anna@example.com"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"rule":"person_or_company_name"`)
+	mockManager.AssertNotCalled(t, "SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPatchCustomerInvalidatesAffectedListings(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	r := newCustomerRouter(mockManager, mockCache)
+
+	mockManager.On("SaveCustomerBulk", mock.Anything, []map[string]interface{}{{"customerID": 10, "groupID": 3}}, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{okSaveItem(10)},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:10"}).Return(nil)
+	// Only pages showing the customer, changedSince listings and the new
+	// group's listings; unfiltered and name search listings are kept.
+	mockCache.On("InvalidateTags", mock.Anything, []string{"customer:10", "filter:changedSince", "filter:groupID=3"}).Return(nil)
+	mockCache.On("Get", mock.Anything, "customer:10").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 10, GroupID: 3}), nil)
+	mockCache.On("Set", mock.Anything, "customer:10", mock.Anything, mock.Anything).Return(nil)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/api/customers/10", bytes.NewReader([]byte(`{"groupID": 3}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockCache.AssertExpectations(t)
+}
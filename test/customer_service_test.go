@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/logger"
+	"erply_test/internal/service"
+	"errors"
+	"testing"
+
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseCustomerIDs(t *testing.T) {
+	ids, err := service.ParseCustomerIDs([]interface{}{float64(1), "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+
+	_, err = service.ParseCustomerIDs([]interface{}{"abc"})
+	assert.True(t, erplyerr.Is(err, erplyerr.KindBadRequest))
+
+	_, err = service.ParseCustomerIDs([]interface{}{true})
+	assert.True(t, erplyerr.Is(err, erplyerr.KindBadRequest))
+
+	ids, err = service.ParseCustomerIDs([]interface{}{float64(4), float64(2147483647)})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 2147483647}, ids)
+
+	// Deleting customer 4 for 4.7 would delete the wrong customer.
+	for _, id := range []interface{}{4.7, float64(-1), float64(0), 1e20, float64(2147483648), "99999999999999999999", "4.7"} {
+		_, err = service.ParseCustomerIDs([]interface{}{float64(1), id})
+		assert.True(t, erplyerr.Is(err, erplyerr.KindBadRequest), id)
+	}
+}
+
+func TestServiceListCustomers(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	svc := service.NewCustomerService(mockManager, mockCache, logger.NewSlogLogger())
+
+	mockCache.On("Get", mock.Anything, "customers:list:e3b0c44298fc1c14:1:20").Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, []map[string]interface{}{{"pageNo": 1, "recordsOnPage": 20}}, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+	mockCache.On("SetWithTags", mock.Anything, "customers:list:e3b0c44298fc1c14:1:20", mock.Anything, service.CacheTTL,
+		[]string{"filter:none", "customer:7"}).Return(nil)
+
+	page, source, err := svc.ListCustomers(context.Background(), service.ListQuery{}, service.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, service.SourceUpstream, source)
+	assert.Equal(t, []service.Customer{{ID: 7, FirstName: "Anna"}}, page.Customers)
+	mockCache.AssertExpectations(t)
+}
+
+func TestServiceExportStopsOnEmitError(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	svc := service.NewCustomerService(mockManager, new(MockCache), logger.NewSlogLogger())
+
+	full := []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}
+	mockManager.On("GetCustomersBulk", mock.Anything, startingAt(1), mock.Anything).
+		Return(exportPages(5000, 1, full...), nil)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := svc.ExportCustomers(context.Background(), service.ListQuery{}, func(total int, batch []service.Customer) error {
+		calls++
+		assert.Equal(t, 5000, total)
+		assert.Len(t, batch, 1000)
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestServiceCreateCustomerRejectsID(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	svc := service.NewCustomerService(mockManager, new(MockCache), logger.NewSlogLogger())
+
+	id := 7
+	_, err := svc.CreateCustomer(context.Background(), service.SaveCustomer{CustomerID: &id, FirstName: "Anna"})
+	assert.True(t, erplyerr.Is(err, erplyerr.KindValidation))
+	mockManager.AssertNotCalled(t, "SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"erply_test/internal/erplyerr"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErplyErrorKinds(t *testing.T) {
+	tests := []struct {
+		name           string
+		code           sharedCommon.ApiError
+		expectedKind   erplyerr.Kind
+		expectedStatus int
+	}{
+		{"Unknown ID", sharedCommon.InvalidClassifierID, erplyerr.KindNotFound, http.StatusNotFound},
+		{"Invalid value", sharedCommon.InvalidValue, erplyerr.KindValidation, http.StatusUnprocessableEntity},
+		{"Session expired", sharedCommon.APISessionExpired, erplyerr.KindAuth, http.StatusBadGateway},
+		{"Hourly quota", sharedCommon.HourlyRequestQuota, erplyerr.KindQuotaExhausted, http.StatusServiceUnavailable},
+		{"Same instance running", sharedCommon.SameInstanceIsRunning, erplyerr.KindRateLimited, http.StatusTooManyRequests},
+		{"Maintenance", sharedCommon.ServerMaintenance, erplyerr.KindUnavailable, http.StatusServiceUnavailable},
+		{"Duplicate", sharedCommon.IdenticalRecordExists, erplyerr.KindConflict, http.StatusConflict},
+		{"Unmapped code", sharedCommon.PrintingServiceFailure, erplyerr.KindInternal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := erplyerr.From(sharedCommon.NewErplyError("error", "request failed", tt.code))
+			assert.Equal(t, tt.expectedKind, e.Kind)
+			assert.Equal(t, tt.expectedStatus, e.HTTPStatus())
+			assert.Equal(t, int(tt.code), e.ErplyCode)
+		})
+	}
+}
+
+func TestErplyQuotaErrorRetriesAtNextHour(t *testing.T) {
+	e := erplyerr.From(sharedCommon.NewErplyError("error", "request quota exceeded", sharedCommon.HourlyRequestQuota))
+
+	assert.Greater(t, e.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, e.RetryAfter, time.Hour)
+	assert.InDelta(t, time.Until(time.Now().Truncate(time.Hour).Add(time.Hour)), e.RetryAfter, float64(time.Second))
+}
+
+func TestErplyErrorTransportFailure(t *testing.T) {
+	err := sharedCommon.NewFromError("getCustomers request failed", errors.New("connection refused"), 0)
+
+	e := erplyerr.From(err)
+
+	assert.Equal(t, erplyerr.KindUnavailable, e.Kind)
+	assert.ErrorIs(t, e, err)
+}
+
+func TestErplyErrorFromBulkUsesItemStatus(t *testing.T) {
+	// The wrapper reports the code of the whole bulk request (0) for a failed item.
+	err := sharedCommon.NewErplyError("error", "saveCustomer failed", 0)
+	status := sharedCommon.StatusBulk{Status: sharedCommon.Status{
+		ResponseStatus: "error", ErrorCode: sharedCommon.InvalidValue, ErrorField: "email",
+	}}
+
+	e := erplyerr.FromBulk(err, status)
+
+	assert.Equal(t, erplyerr.KindValidation, e.Kind)
+	assert.Equal(t, "email", e.Field)
+	assert.Equal(t, erplyerr.Body{
+		Code:      erplyerr.KindValidation,
+		Message:   "Erply rejected the input",
+		Field:     "email",
+		RequestID: "req-1",
+	}, e.Body("req-1"))
+}
@@ -3,10 +3,17 @@ package test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"erply_test/internal/api"
+	"erply_test/internal/erplyerr"
 	"erply_test/internal/logger"
+	"erply_test/internal/service"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,6 +46,9 @@ func (m *MockCustomerManager) DeleteCustomerBulk(ctx context.Context, bulk []map
 
 func (m *MockCustomerManager) SaveCustomerBulk(ctx context.Context, bulk []map[string]interface{}, opts map[string]string) (customers.SaveCustomerResponseBulk, error) {
 	args := m.Called(ctx, bulk, opts)
+	if fn, ok := args.Get(0).(func(context.Context, []map[string]interface{}, map[string]string) customers.SaveCustomerResponseBulk); ok {
+		return fn(ctx, bulk, opts), args.Error(1)
+	}
 	if result, ok := args.Get(0).(customers.SaveCustomerResponseBulk); ok {
 		return result, args.Error(1)
 	}
@@ -59,27 +69,58 @@ func (m *MockCache) Set(ctx context.Context, key, value string, ttl time.Duratio
 	return args.Error(0)
 }
 
+func (m *MockCache) SetWithTags(ctx context.Context, key, value string, ttl time.Duration, tags ...string) error {
+	args := m.Called(ctx, key, value, ttl, tags)
+	return args.Error(0)
+}
+
+func (m *MockCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	args := m.Called(ctx, tags)
+	return args.Error(0)
+}
+
 func (m *MockCache) Delete(ctx context.Context, keys ...string) error {
 	args := m.Called(ctx, keys)
 	return args.Error(0)
 }
 
+// TryLock always succeeds, so read-through tests only need to mock Get and
+// Set. Lock contention is tested against MemoryCache.
+func (m *MockCache) TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (m *MockCache) Unlock(ctx context.Context, key, token string) error {
+	return nil
+}
+
 func (m *MockCache) Close() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+func newTestHandler(mockManager *MockCustomerManager, mockCache *MockCache) *api.APIHandler {
+	log := logger.NewSlogLogger()
+	return api.NewHandler(gin.Default(), log, service.NewCustomerService(mockManager, mockCache, log))
+}
+
 func TestSaveCustomers(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockManager := new(MockCustomerManager)
 	mockCache := new(MockCache)
-	handler := api.NewHandler(gin.Default(), logger.NewSlogLogger(), mockManager, mockCache)
+	handler := newTestHandler(mockManager, mockCache)
 
 	r := gin.Default()
 	r.POST("/api/customers/save", handler.SaveCustomers)
 
-	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
-	mockCache.On("Delete", mock.Anything, mock.AnythingOfType("[]string")).Return(nil)
+	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{okSaveItem(501)},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:501"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, []string{
+		"customer:501", "filter:none", "filter:changedSince", "filter:email=anna@example.com", "filter:name",
+	}).Return(nil)
 
 	body := []byte(`{"customers": [{"firstName": "Anna", "lastName": "Taylor", "companyName": "Company 1", "email": "anna@example.com"}]}`)
 	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader(body))
@@ -96,11 +137,11 @@ func TestGetCustomers(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockManager := new(MockCustomerManager)
 	mockCache := new(MockCache)
-	handler := api.NewHandler(gin.Default(), logger.NewSlogLogger(), mockManager, mockCache)
+	handler := newTestHandler(mockManager, mockCache)
 
 	r := gin.Default()
 	r.GET("/api/customers", handler.GetCustomers)
-	mockCache.On("Get", mock.Anything, "customers").Return("", nil)
+	mockCache.On("Get", mock.Anything, "customers:list:e3b0c44298fc1c14:1:20").Return("", nil)
 	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
 		Return(customers.GetCustomersResponseBulk{
 			Status: sharedCommon.Status{ResponseStatus: "ok"},
@@ -142,7 +183,8 @@ func TestGetCustomers(t *testing.T) {
 			},
 		}, nil)
 
-	mockCache.On("Set", mock.Anything, "customers", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("SetWithTags", mock.Anything, "customers:list:e3b0c44298fc1c14:1:20", mock.Anything, mock.Anything,
+		[]string{"filter:none", "customer:123", "customer:124", "customer:125"}).Return(nil)
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/customers", nil)
 	w := httptest.NewRecorder()
@@ -153,17 +195,115 @@ func TestGetCustomers(t *testing.T) {
 	mockCache.AssertExpectations(t)
 }
 
+func TestGetCustomersWithFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.GET("/api/customers", handler.GetCustomers)
+
+	cacheKey := "customers:list:addf4372c6e2d17c:2:10"
+	expectedFilters := []map[string]interface{}{
+		{"pageNo": 2, "recordsOnPage": 10, "email": "anna@example.com"},
+	}
+	mockCache.On("Get", mock.Anything, cacheKey).Return("", nil)
+	mockManager.On("GetCustomersBulk", mock.Anything, expectedFilters, mock.Anything).
+		Return(customers.GetCustomersResponseBulk{
+			Status: sharedCommon.Status{ResponseStatus: "ok"},
+			BulkItems: []customers.GetCustomersResponseBulkItem{
+				{
+					Status: sharedCommon.StatusBulk{
+						Status: sharedCommon.Status{ResponseStatus: "ok", RecordsTotal: 35},
+					},
+					Customers: []customers.Customer{{ID: 123, Email: "anna@example.com"}},
+				},
+			},
+		}, nil)
+	mockCache.On("SetWithTags", mock.Anything, cacheKey, mock.Anything, mock.Anything,
+		[]string{"filter:email=anna@example.com", "customer:123"}).Return(nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers?pageNo=2&recordsOnPage=10&email=anna@example.com", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(35), body["total"])
+	assert.Equal(t, "upstream", body["meta"].(map[string]interface{})["source"])
+	customerList := body["customers"].([]interface{})
+	assert.Len(t, customerList, 1)
+	assert.Equal(t, "anna@example.com", customerList[0].(map[string]interface{})["email"])
+	links := body["links"].(map[string]interface{})
+	assert.Equal(t, "/api/customers?email=anna%40example.com&pageNo=3&recordsOnPage=10", links["next"])
+	assert.Equal(t, "/api/customers?email=anna%40example.com&pageNo=1&recordsOnPage=10", links["previous"])
+	mockManager.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestGetCustomersFromCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.GET("/api/customers", handler.GetCustomers)
+
+	cached := encodeCached(t, service.CustomerPage{
+		Customers: []service.Customer{{ID: 7, CompanyName: "Oruel Inc"}},
+		Total:     1,
+		FetchedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	mockCache.On("Get", mock.Anything, "customers:list:e3b0c44298fc1c14:1:20").Return(cached, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp api.CustomerListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []service.Customer{{ID: 7, CompanyName: "Oruel Inc"}}, resp.Customers)
+	assert.Equal(t, "cache", resp.Meta.Source)
+	assert.Equal(t, "2024-01-02T03:04:05Z", resp.Meta.FetchedAt.Format(time.RFC3339))
+	mockManager.AssertNotCalled(t, "GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetCustomersInvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.GET("/api/customers", handler.GetCustomers)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers?recordsOnPage=500", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockManager.AssertNotCalled(t, "GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestDeleteCustomers(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockManager := new(MockCustomerManager)
 	mockCache := new(MockCache)
-	handler := api.NewHandler(gin.Default(), logger.NewSlogLogger(), mockManager, mockCache)
+	handler := newTestHandler(mockManager, mockCache)
 
 	r := gin.Default()
 	r.DELETE("/api/customers/delete", handler.DeleteCustomers)
 
-	mockManager.On("DeleteCustomerBulk", mock.Anything, mock.Anything, mock.Anything).Return(customers.DeleteCustomersResponseBulk{}, nil)
-	mockCache.On("Delete", mock.Anything, mock.AnythingOfType("[]string")).Return(nil)
+	mockManager.On("DeleteCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{
+			BulkItems: []customers.DeleteCustomerResponseBulkItem{okDeleteItem(), okDeleteItem(), okDeleteItem()},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, []string{"customer:1", "customer:2", "customer:3"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, []string{"customer:1", "filter:none", "customer:2", "customer:3"}).Return(nil)
 
 	body := []byte(`{"customerIDs": [1, 2, 3]}`)
 	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/delete", bytes.NewReader(body))
@@ -175,3 +315,405 @@ func TestDeleteCustomers(t *testing.T) {
 	mockManager.AssertExpectations(t)
 	mockCache.AssertExpectations(t)
 }
+
+func okSaveItem(id int) customers.SaveCustomerResponseBulkItem {
+	return customers.SaveCustomerResponseBulkItem{
+		Status:  sharedCommon.StatusBulk{Status: sharedCommon.Status{ResponseStatus: "ok"}},
+		Records: []customers.SaveCustomerResp{{CustomerID: id}},
+	}
+}
+
+func okDeleteItem() customers.DeleteCustomerResponseBulkItem {
+	return customers.DeleteCustomerResponseBulkItem{
+		Status: sharedCommon.StatusBulk{Status: sharedCommon.Status{ResponseStatus: "ok"}},
+	}
+}
+
+func TestSaveCustomersMapsAllFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.POST("/api/customers/save", handler.SaveCustomers)
+
+	expected := []map[string]interface{}{{
+		"companyName":     "Oruel Inc",
+		"address":         "Tamsare pst 12",
+		"code":            "12345678",
+		"vatNumber":       "EE123456789",
+		"groupID":         3,
+		"paymentDays":     14,
+		"credit":          5000,
+		"taxExempt":       1,
+		"emailOptOut":     0,
+		"attributeName1":  "segment",
+		"attributeType1":  "text",
+		"attributeValue1": "retail",
+	}}
+	mockManager.On("SaveCustomerBulk", mock.Anything, expected, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{okSaveItem(501)},
+		}, nil)
+	mockCache.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	body := []byte(`{"customers": [{
+		"companyName": "Oruel Inc", "address": "Tamsare pst 12", "code": "12345678", "vatNumber": "EE123456789",
+		"groupID": 3, "paymentDays": 14, "creditLimit": 5000, "taxExempt": true, "emailOptOut": false,
+		"attributes": [{"name": "segment", "value": "retail"}]
+	}]}`)
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockManager.AssertExpectations(t)
+}
+
+func TestSaveCustomersPartialFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.POST("/api/customers/save", handler.SaveCustomers)
+
+	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{
+			BulkItems: []customers.SaveCustomerResponseBulkItem{
+				okSaveItem(501),
+				{Status: sharedCommon.StatusBulk{Status: sharedCommon.Status{
+					ResponseStatus: "error", ErrorCode: sharedCommon.InvalidValue, ErrorField: "email",
+				}}},
+				okSaveItem(7),
+			},
+		}, errors.New("ERPLY API: error, code: 1016"))
+	mockCache.On("Delete", mock.Anything, []string{"customer:501", "customer:7"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	body := []byte(`{"customers": [{"firstName": "Anna"}, {"firstName": "Bad", "email": "taken@example.com"}, {"customerID": 7, "phone": "+372 5551234"}]}`)
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	var resp service.BulkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []service.ItemResult{
+		{Index: 0, CustomerID: 501, Status: "created"},
+		{Index: 1, Status: "failed", ErrorCode: 1016, Field: "email", Error: erplyerr.KindValidation},
+		{Index: 2, CustomerID: 7, Status: "updated"},
+	}, resp.Results)
+	assert.Equal(t, service.BulkSummary{Succeeded: 2, Failed: 1}, resp.Summary)
+	mockCache.AssertExpectations(t)
+}
+
+func TestDeleteCustomersPartialFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.DELETE("/api/customers/delete", handler.DeleteCustomers)
+
+	mockManager.On("DeleteCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{
+			BulkItems: []customers.DeleteCustomerResponseBulkItem{
+				okDeleteItem(),
+				{Status: sharedCommon.StatusBulk{Status: sharedCommon.Status{
+					ResponseStatus: "error", ErrorCode: sharedCommon.InvalidClassifierID, ErrorField: "customerID",
+				}}},
+			},
+		}, errors.New("ERPLY API: error, code: 1011"))
+	mockCache.On("Delete", mock.Anything, []string{"customer:1", "customer:2"}).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	body := []byte(`{"customerIDs": [1, "2"]}`)
+	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/delete", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	var resp service.BulkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []service.ItemResult{
+		{Index: 0, CustomerID: 1, Status: "deleted"},
+		{Index: 1, CustomerID: 2, Status: "not_found", ErrorCode: 1011, Field: "customerID", Error: erplyerr.KindNotFound},
+	}, resp.Results)
+}
+
+func TestBulkAllFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	failedItem := func(code sharedCommon.ApiError) sharedCommon.StatusBulk {
+		return sharedCommon.StatusBulk{Status: sharedCommon.Status{ResponseStatus: "error", ErrorCode: code}}
+	}
+
+	for name, tt := range map[string]struct {
+		codes      []sharedCommon.ApiError
+		status     int
+		retryAfter bool
+	}{
+		"not found":       {[]sharedCommon.ApiError{sharedCommon.InvalidClassifierID, sharedCommon.InvalidClassifierID}, http.StatusNotFound, false},
+		"highest status":  {[]sharedCommon.ApiError{sharedCommon.InvalidClassifierID, sharedCommon.RelatedDeletionError}, http.StatusConflict, false},
+		"quota exhausted": {[]sharedCommon.ApiError{sharedCommon.HourlyRequestQuota, sharedCommon.HourlyRequestQuota}, http.StatusServiceUnavailable, true},
+	} {
+		mockManager := new(MockCustomerManager)
+		mockCache := new(MockCache)
+		handler := newTestHandler(mockManager, mockCache)
+		r := gin.Default()
+		r.DELETE("/api/customers/delete", handler.DeleteCustomers)
+
+		var items []customers.DeleteCustomerResponseBulkItem
+		for _, code := range tt.codes {
+			items = append(items, customers.DeleteCustomerResponseBulkItem{Status: failedItem(code)})
+		}
+		mockManager.On("DeleteCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+			Return(customers.DeleteCustomersResponseBulk{BulkItems: items}, nil)
+		mockCache.On("Delete", mock.Anything, mock.Anything).Return(nil)
+		mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/api/customers/delete", bytes.NewReader([]byte(`{"customerIDs": [1, 2]}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code, name)
+		assert.Equal(t, tt.retryAfter, w.Header().Get("Retry-After") != "", name)
+		var resp service.BulkResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), name)
+		assert.Equal(t, service.BulkSummary{Failed: 2}, resp.Summary, name)
+	}
+
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+	r := gin.Default()
+	r.POST("/api/customers/save", handler.SaveCustomers)
+	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{BulkItems: []customers.SaveCustomerResponseBulkItem{
+			{Status: failedItem(sharedCommon.InvalidValue)},
+		}}, errors.New("ERPLY API: error, code: 1016"))
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader([]byte(`{"customers": [{"firstName": "Anna"}]}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestBulkAllFailedWithRefusedChunk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+	r := gin.Default()
+	r.DELETE("/api/customers/delete", handler.DeleteCustomers)
+
+	notFound := make([]customers.DeleteCustomerResponseBulkItem, 100)
+	for i := range notFound {
+		notFound[i] = customers.DeleteCustomerResponseBulkItem{Status: sharedCommon.StatusBulk{Status: sharedCommon.Status{
+			ResponseStatus: "error", ErrorCode: sharedCommon.InvalidClassifierID,
+		}}}
+	}
+	firstChunk := mock.MatchedBy(func(bulk []map[string]interface{}) bool { return bulk[0]["customerID"] == "1" })
+	secondChunk := mock.MatchedBy(func(bulk []map[string]interface{}) bool { return bulk[0]["customerID"] == "101" })
+	mockManager.On("DeleteCustomerBulk", mock.Anything, firstChunk, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{BulkItems: notFound}, nil)
+	// The quota governor refuses the second chunk before it reaches Erply.
+	mockManager.On("DeleteCustomerBulk", mock.Anything, secondChunk, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{}, erplyerr.QuotaExhausted("Erply hourly request limit of 100 reached", 20*time.Minute))
+	mockCache.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	var ids []int
+	for i := 1; i <= 150; i++ {
+		ids = append(ids, i)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"customerIDs": ids})
+	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/delete", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1200", w.Header().Get("Retry-After"))
+	var resp service.BulkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, service.BulkSummary{Failed: 150}, resp.Summary)
+	assert.Equal(t, service.ItemResult{Index: 0, CustomerID: 1, Status: "not_found", ErrorCode: 1011, Error: erplyerr.KindNotFound}, resp.Results[0])
+	assert.Equal(t, service.ItemResult{Index: 100, CustomerID: 101, Status: "failed", Error: erplyerr.KindQuotaExhausted, RetryAfter: 1200}, resp.Results[100])
+}
+
+func TestSaveCustomersValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.POST("/api/customers/save", handler.SaveCustomers)
+
+	body := []byte(`{"customers": [
+		{"firstName": "Anna", "email": "anna@example.com"},
+		{"email": "not-an-email"},
+		{"customerID": 7, "gender": "other", "birthday": "17.05.1990", "attributes": [{"value": "x"}]}
+	]}`)
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var resp struct {
+		Code       string `json:"code"`
+		Violations []struct {
+			Index int    `json:"index"`
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"violations"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "validation_error", resp.Code)
+
+	var got []string
+	for _, v := range resp.Violations {
+		got = append(got, fmt.Sprintf("%d:%s:%s", v.Index, v.Field, v.Rule))
+	}
+	assert.ElementsMatch(t, []string{
+		"1:companyName:person_or_company_name",
+		"1:email:email",
+		"2:birthday:datetime",
+		"2:gender:oneof",
+		"2:attributes[0].name:required",
+	}, got)
+	mockManager.AssertNotCalled(t, "SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSaveCustomersChunked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.POST("/api/customers/save", handler.SaveCustomers)
+
+	// Every chunk returns its items with IDs derived from the input code, so
+	// the merged results can be checked against the input order.
+	var mu sync.Mutex
+	var sizes []int
+	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(_ context.Context, bulk []map[string]interface{}, _ map[string]string) customers.SaveCustomerResponseBulk {
+			mu.Lock()
+			sizes = append(sizes, len(bulk))
+			mu.Unlock()
+			var resp customers.SaveCustomerResponseBulk
+			for _, item := range bulk {
+				id, _ := strconv.Atoi(item["code"].(string))
+				resp.BulkItems = append(resp.BulkItems, okSaveItem(id))
+			}
+			return resp
+		}, nil)
+	mockCache.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	var input []map[string]string
+	for i := 0; i < 250; i++ {
+		input = append(input, map[string]string{"firstName": "Anna", "code": strconv.Itoa(1000 + i)})
+	}
+	body, _ := json.Marshal(map[string]interface{}{"customers": input})
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.ElementsMatch(t, []int{100, 100, 50}, sizes)
+	var resp service.BulkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Results, 250)
+	for i, res := range resp.Results {
+		assert.Equal(t, i, res.Index)
+		assert.Equal(t, 1000+i, res.CustomerID)
+	}
+	assert.Equal(t, service.BulkSummary{Succeeded: 250}, resp.Summary)
+}
+
+func TestDeleteCustomersChunkFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	mockCache := new(MockCache)
+	handler := newTestHandler(mockManager, mockCache)
+
+	r := gin.Default()
+	r.DELETE("/api/customers/delete", handler.DeleteCustomers)
+
+	okItems := make([]customers.DeleteCustomerResponseBulkItem, 100)
+	for i := range okItems {
+		okItems[i] = okDeleteItem()
+	}
+	firstChunk := mock.MatchedBy(func(bulk []map[string]interface{}) bool {
+		return bulk[0]["customerID"] == "1"
+	})
+	secondChunk := mock.MatchedBy(func(bulk []map[string]interface{}) bool {
+		return bulk[0]["customerID"] == "101"
+	})
+	mockManager.On("DeleteCustomerBulk", mock.Anything, firstChunk, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{BulkItems: okItems}, nil)
+	mockManager.On("DeleteCustomerBulk", mock.Anything, secondChunk, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{}, sharedCommon.NewErplyError("Error", "request quota exceeded", sharedCommon.HourlyRequestQuota))
+	mockCache.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	mockCache.On("InvalidateTags", mock.Anything, mock.Anything).Return(nil)
+
+	var ids []int
+	for i := 1; i <= 150; i++ {
+		ids = append(ids, i)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"customerIDs": ids})
+	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/delete", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	var resp service.BulkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Results, 150)
+	assert.Equal(t, service.BulkSummary{Succeeded: 100, Failed: 50}, resp.Summary)
+	failed := resp.Results[100]
+	assert.Positive(t, failed.RetryAfter)
+	assert.LessOrEqual(t, failed.RetryAfter, 3600)
+	failed.RetryAfter = 0
+	assert.Equal(t, service.ItemResult{Index: 100, CustomerID: 101, Status: "failed", ErrorCode: 1002, Error: erplyerr.KindQuotaExhausted}, failed)
+	mockManager.AssertNumberOfCalls(t, "DeleteCustomerBulk", 2)
+}
+
+func TestSaveCustomersTooMany(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockManager := new(MockCustomerManager)
+	handler := newTestHandler(mockManager, new(MockCache))
+
+	r := gin.Default()
+	r.POST("/api/customers/save", handler.SaveCustomers)
+
+	input := make([]map[string]string, 5001)
+	for i := range input {
+		input[i] = map[string]string{"firstName": "Anna"}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"customers": input})
+	req, _ := http.NewRequest(http.MethodPost, "/api/customers/save", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockManager.AssertNotCalled(t, "SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything)
+}
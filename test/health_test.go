@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"erply_test/internal/api"
+	"erply_test/internal/logger"
+	"erply_test/internal/quota"
+	"erply_test/internal/service"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHealthRouter(deps ...service.Dependency) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := api.NewHealthHandler(service.NewHealthService(service.BuildInfo{Version: "1.2.3", Commit: "abc"}, deps...), nil)
+	r := gin.New()
+	r.GET("/health/live", h.GetLive)
+	r.GET("/health/ready", h.GetReady)
+	return r
+}
+
+func getReady(t *testing.T, r *gin.Engine) (int, service.Readiness) {
+	req, _ := http.NewRequest(http.MethodGet, "/health/ready", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var ready service.Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ready))
+	return w.Code, ready
+}
+
+func checkResult(err error) func(context.Context) error {
+	return func(context.Context) error { return err }
+}
+
+func TestHealthLive(t *testing.T) {
+	r := newHealthRouter(service.Dependency{Name: "erply", Required: true, Check: checkResult(errors.New("down"))})
+	req, _ := http.NewRequest(http.MethodGet, "/health/live", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHealthReady(t *testing.T) {
+	r := newHealthRouter(
+		service.Dependency{Name: "erply", Required: true, Check: checkResult(nil)},
+		service.Dependency{Name: "redis", Check: checkResult(errors.New("connection refused"))},
+	)
+	code, ready := getReady(t, r)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, service.StatusReady, ready.Status)
+	assert.Equal(t, "1.2.3", ready.Build.Version)
+	assert.Equal(t, "abc", ready.Build.Commit)
+	assert.Equal(t, service.DependencyUp, ready.Dependencies["erply"].Status)
+	assert.True(t, ready.Dependencies["erply"].Required)
+	assert.Equal(t, service.DependencyDown, ready.Dependencies["redis"].Status)
+	assert.Equal(t, "connection refused", ready.Dependencies["redis"].Error)
+}
+
+func TestHealthNotReadyWhenRequiredDependencyDown(t *testing.T) {
+	r := newHealthRouter(
+		service.Dependency{Name: "erply", Required: true, Check: checkResult(errors.New("session expired"))},
+		service.Dependency{Name: "redis", Check: checkResult(nil)},
+	)
+	code, ready := getReady(t, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, service.StatusNotReady, ready.Status)
+	assert.Equal(t, service.DependencyDown, ready.Dependencies["erply"].Status)
+}
+
+func TestHealthReadyReusesCachedCheck(t *testing.T) {
+	var calls atomic.Int32
+	r := newHealthRouter(service.Dependency{
+		Name:     "erply",
+		Required: true,
+		Check: func(context.Context) error {
+			calls.Add(1)
+			return nil
+		},
+		CacheFor: time.Minute,
+	})
+	for i := 0; i < 3; i++ {
+		code, _ := getReady(t, r)
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func sessionInfoClient(status int, expires time.Time) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := fmt.Sprintf(`{"status":{"responseStatus":"ok"},"records":[{"creationUnixTime":"0","expireUnixTime":"%d"}]}`, expires.Unix())
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	})}
+}
+
+func TestErplySessionCheck(t *testing.T) {
+	session := func() (string, error) { return "sk", nil }
+	ctx := context.Background()
+
+	valid := service.ErplySessionCheck(session, "123", sessionInfoClient(http.StatusOK, time.Now().Add(time.Hour)))
+	assert.NoError(t, valid(ctx))
+
+	expired := service.ErplySessionCheck(session, "123", sessionInfoClient(http.StatusOK, time.Now().Add(-time.Hour)))
+	assert.ErrorContains(t, expired(ctx), "expired")
+
+	unreachable := service.ErplySessionCheck(session, "123", sessionInfoClient(http.StatusBadGateway, time.Now()))
+	assert.Error(t, unreachable(ctx))
+
+	noSession := service.ErplySessionCheck(func() (string, error) { return "", errors.New("no key") }, "123", sessionInfoClient(http.StatusOK, time.Now()))
+	assert.Error(t, noSession(ctx))
+}
+
+func TestErplyCheckQuotaExhaustedStaysReady(t *testing.T) {
+	refused := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"status":{"responseStatus":"error","errorCode":1002},"records":[]}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	})}
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 100}, logger.NewSlogLogger())
+	check := service.CheckWithQuota(service.ErplySessionCheck(func() (string, error) { return "sk", nil }, "123", refused), g)
+	r := newHealthRouter(service.Dependency{Name: "erply", Required: true, Check: check})
+
+	code, ready := getReady(t, r)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, service.StatusReady, ready.Status)
+	assert.Equal(t, service.DependencyDegraded, ready.Dependencies["erply"].Status)
+	assert.NotEmpty(t, ready.Dependencies["erply"].Error)
+	assert.Equal(t, 0, g.Status(context.Background()).Remaining)
+}
@@ -0,0 +1,242 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"erply_test/internal/app"
+	"erply_test/internal/auth"
+	"erply_test/internal/logger"
+	"erply_test/internal/middleware"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://id.example.com"
+	testAudience = "customers-api"
+)
+
+type testSigner struct {
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &testSigner{rsaKey: rsaKey, ecKey: ecKey}
+}
+
+func (s *testSigner) jwks() []byte {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(s.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(s.rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(s.ecKey.X.FillBytes(make([]byte, 32))), "y": b64(s.ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "enc1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	return data
+}
+
+func (s *testSigner) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	method, key := jwt.SigningMethod(jwt.SigningMethodRS256), any(s.rsaKey)
+	if kid == "ec1" {
+		method, key = jwt.SigningMethodES256, s.ecKey
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "svc-billing",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": "openid crm.read customers:delete",
+		"roles": []string{"crm-readers"},
+	}
+}
+
+func newTestVerifier(t *testing.T, signer *testSigner) *auth.JWTVerifier {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, signer.jwks(), 0o600))
+	verifier, err := auth.NewJWTVerifier(auth.NewJWKS(path, nil, time.Hour), auth.JWTConfig{
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		ScopeMap: map[string]string{"crm.read": auth.ScopeCustomersRead},
+		RoleMap:  map[string]string{"crm-readers": string(auth.RoleReadOnly), "crm-admins": string(auth.RoleAdmin)},
+	})
+	require.NoError(t, err)
+	return verifier
+}
+
+func TestJWTVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier := newTestVerifier(t, signer)
+	ctx := context.Background()
+
+	for _, kid := range []string{"rsa1", "ec1"} {
+		principal, err := verifier.Verify(ctx, signer.sign(t, kid, validClaims()))
+		require.NoError(t, err, kid)
+		assert.Equal(t, "jwt:svc-billing", principal.ID)
+		assert.Equal(t, []string{auth.ScopeCustomersRead, auth.ScopeCustomersDelete}, principal.Scopes)
+	}
+}
+
+func TestJWTVerifyRejects(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier := newTestVerifier(t, signer)
+	other := newTestSigner(t)
+
+	with := func(key string, value any) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	for name, token := range map[string]string{
+		"wrong issuer":   signer.sign(t, "rsa1", with("iss", "https://evil.example.com")),
+		"wrong audience": signer.sign(t, "rsa1", with("aud", "other-api")),
+		"expired":        signer.sign(t, "rsa1", with("exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":      signer.sign(t, "rsa1", with("exp", nil)),
+		"no subject":     signer.sign(t, "rsa1", with("sub", nil)),
+		"unknown kid":    signer.sign(t, "rsa2", validClaims()),
+		"wrong key":      other.sign(t, "rsa1", validClaims()),
+		"garbage":        "not.a.token",
+	} {
+		_, err := verifier.Verify(context.Background(), token)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken, name)
+	}
+}
+
+func TestJWKSFromURLIsCached(t *testing.T) {
+	signer := newTestSigner(t)
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(signer.jwks())
+	}))
+	defer srv.Close()
+
+	verifier, err := auth.NewJWTVerifier(auth.NewJWKS(srv.URL, srv.Client(), time.Hour), auth.JWTConfig{Issuer: testIssuer, Audience: testAudience})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := verifier.Verify(context.Background(), signer.sign(t, "rsa1", validClaims()))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestJWKSRefreshDoesNotBlockVerification(t *testing.T) {
+	signer := newTestSigner(t)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		_, _ = w.Write(signer.jwks())
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	verifier, err := auth.NewJWTVerifier(auth.NewJWKS(srv.URL, srv.Client(), 20*time.Millisecond), auth.JWTConfig{Issuer: testIssuer, Audience: testAudience})
+	require.NoError(t, err)
+	token := signer.sign(t, "rsa1", validClaims())
+	_, err = verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	// The keys expired and the provider hangs: tokens are still verified
+	// with the keys at hand while one refetch runs.
+	time.Sleep(30 * time.Millisecond)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := verifier.Verify(context.Background(), token)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestNewJWTVerifierInvalidConfig(t *testing.T) {
+	jwks := auth.NewJWKS("jwks.json", nil, time.Hour)
+	_, err := auth.NewJWTVerifier(jwks, auth.JWTConfig{Audience: testAudience})
+	assert.Error(t, err)
+	_, err = auth.NewJWTVerifier(jwks, auth.JWTConfig{Issuer: testIssuer, Audience: testAudience, ScopeMap: map[string]string{"crm.all": "customers:all"}})
+	assert.Error(t, err)
+}
+
+func TestAuthMiddlewareBearer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	signer := newTestSigner(t)
+	keys := newKeyStore(t, auth.NewAPIKey("test", "valid_key", auth.AllScopes...))
+	router := gin.New()
+	router.Use(middleware.AuthMiddleware(keys, newTestVerifier(t, signer)))
+	router.GET("/customers", middleware.Authorize(logger.NewSlogLogger(), auth.ScopeCustomersRead, auth.RoleReadOnly), func(c *gin.Context) {
+		principal, _ := middleware.GetPrincipal(c)
+		c.String(http.StatusOK, principal.ID)
+	})
+
+	for name, tt := range map[string]struct {
+		header, value string
+		code          int
+		body          string
+	}{
+		"bearer":        {"Authorization", "Bearer " + signer.sign(t, "rsa1", validClaims()), http.StatusOK, "jwt:svc-billing"},
+		"invalid token": {"Authorization", "Bearer nope", http.StatusUnauthorized, `{"error":"Invalid bearer token"}`},
+		"api key":       {"X-API-KEY", "valid_key", http.StatusOK, "apikey:test"},
+		"nothing":       {"X-Other", "x", http.StatusUnauthorized, `{"error":"API key or bearer token is required"}`},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "/customers", nil)
+		req.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.code, w.Code, name)
+		assert.Equal(t, tt.body, w.Body.String(), name)
+	}
+}
+
+func TestJWTScopeMapFromEnv(t *testing.T) {
+	var cfg app.Config
+	err := env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{
+		"JWT_SCOPE_MAP": "crm.read=customers:read,crm.write=customers:write",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"crm.read": auth.ScopeCustomersRead, "crm.write": auth.ScopeCustomersWrite}, cfg.JWTScopeMap)
+}
@@ -0,0 +1,321 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"erply_test/internal/api"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/logger"
+	"erply_test/internal/quota"
+	"erply_test/internal/service"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	sharedCommon "github.com/erply/api-go-wrapper/pkg/api/common"
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaRejectsWhenUsedUp(t *testing.T) {
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 2}, logger.NewSlogLogger())
+	ctx := context.Background()
+	require.NoError(t, g.Acquire(ctx, 1))
+	require.NoError(t, g.Acquire(ctx, 1))
+
+	err := g.Acquire(ctx, 1)
+	var e *erplyerr.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, erplyerr.KindQuotaExhausted, e.Kind)
+	assert.Equal(t, http.StatusServiceUnavailable, e.HTTPStatus())
+	assert.Greater(t, e.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, e.RetryAfter, time.Hour)
+
+	status := g.Status(ctx)
+	assert.Equal(t, 2, status.Limit)
+	assert.Equal(t, 2, status.Used)
+	assert.Equal(t, 0, status.Remaining)
+	assert.Equal(t, int64(1), status.Rejected)
+	assert.True(t, status.Shared)
+	assert.Equal(t, time.Now().UTC().Truncate(time.Hour).Add(time.Hour), status.ResetAt)
+}
+
+func TestQuotaPacesReserve(t *testing.T) {
+	if time.Until(time.Now().Truncate(time.Hour).Add(time.Hour)) < time.Minute {
+		t.Skip("too close to the quota reset")
+	}
+	// All of the quota is reserve, so calls are spread over the hour: the
+	// second one would have to wait minutes.
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 10, Reserve: 10, MaxWait: 50 * time.Millisecond}, logger.NewSlogLogger())
+	ctx := context.Background()
+	require.NoError(t, g.Acquire(ctx, 1))
+
+	err := g.Acquire(ctx, 1)
+	assert.True(t, erplyerr.Is(err, erplyerr.KindQuotaExhausted))
+	assert.Greater(t, erplyerr.From(err).RetryAfter, 50*time.Millisecond)
+	assert.Equal(t, 1, g.Status(ctx).Used)
+}
+
+func TestQuotaRecordIsNeverRefused(t *testing.T) {
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 1}, logger.NewSlogLogger())
+	ctx := context.Background()
+	g.Record(ctx)
+	g.Record(ctx)
+	assert.Equal(t, 2, g.Status(ctx).Used)
+	assert.Error(t, g.Acquire(ctx, 1))
+}
+
+func TestQuotaCountsBulkItems(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 5}, logger.NewSlogLogger())
+	m := service.WithQuota(mockManager, g)
+	ctx := context.Background()
+	mockManager.On("SaveCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.SaveCustomerResponseBulk{}, nil)
+	bulk := func(n int) []map[string]interface{} { return make([]map[string]interface{}, n) }
+
+	_, err := m.SaveCustomerBulk(ctx, bulk(3), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, g.Status(ctx).Used)
+
+	// A call that does not fit in the rest of the quota is refused whole.
+	_, err = m.SaveCustomerBulk(ctx, bulk(3), nil)
+	assert.True(t, erplyerr.Is(err, erplyerr.KindQuotaExhausted))
+	_, err = m.SaveCustomerBulk(ctx, bulk(2), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, g.Status(ctx).Used)
+	mockManager.AssertNumberOfCalls(t, "SaveCustomerBulk", 2)
+}
+
+type failingCounter struct{}
+
+func (failingCounter) Take(ctx context.Context, key string, n, limit int, ttl time.Duration) (bool, int, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func (failingCounter) Count(ctx context.Context, key string) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (failingCounter) Raise(ctx context.Context, key string, n int, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestQuotaFallsBackToMemory(t *testing.T) {
+	g := quota.NewGovernor(failingCounter{}, "acme", quota.Config{Limit: 1}, logger.NewSlogLogger())
+	ctx := context.Background()
+	require.NoError(t, g.Acquire(ctx, 1))
+	assert.Error(t, g.Acquire(ctx, 1))
+
+	status := g.Status(ctx)
+	assert.Equal(t, 1, status.Used)
+	assert.False(t, status.Shared)
+}
+
+func TestQuotaExhaustedResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log := logger.NewSlogLogger()
+	mockManager := new(MockCustomerManager)
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 1}, log)
+	g.Record(context.Background())
+
+	r := gin.New()
+	handler := api.NewHandler(r, log, service.NewCustomerService(service.WithQuota(mockManager, g), newMemoryCache(t), log))
+	r.GET("/api/customers/:id", handler.GetCustomer)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/customers/1", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.Positive(t, retryAfter)
+	assert.LessOrEqual(t, retryAfter, 3600)
+	var body erplyerr.Body
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, erplyerr.KindQuotaExhausted, body.Code)
+	mockManager.AssertNotCalled(t, "GetCustomersBulk")
+}
+
+func TestQuotaExhaustedByErply(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 100}, logger.NewSlogLogger())
+	m := service.WithQuota(mockManager, g)
+	ctx := context.Background()
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.GetCustomersResponseBulk{}, sharedCommon.NewErplyError("Error", "request quota exceeded", sharedCommon.HourlyRequestQuota)).Once()
+
+	_, err := m.GetCustomersBulk(ctx, nil, nil)
+	e := erplyerr.From(err)
+	assert.Equal(t, erplyerr.KindQuotaExhausted, e.Kind)
+	assert.Greater(t, e.RetryAfter, time.Duration(0))
+
+	// The rest of the hour is not sent to Erply.
+	_, err = m.GetCustomersBulk(ctx, nil, nil)
+	assert.True(t, erplyerr.Is(err, erplyerr.KindQuotaExhausted))
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+	assert.Equal(t, 0, g.Status(ctx).Remaining)
+}
+
+func TestQuotaReported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := quota.NewGovernor(quota.NewMemoryCounter(), "acme", quota.Config{Limit: 100}, logger.NewSlogLogger())
+	require.NoError(t, g.Acquire(context.Background(), 1))
+
+	r := gin.New()
+	r.GET("/health/ready", api.NewHealthHandler(service.NewHealthService(service.BuildInfo{}), g).GetReady)
+	r.GET("/metrics", api.NewMetricsHandler(g).GetMetrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/health/ready", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var ready service.Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ready))
+	require.NotNil(t, ready.ErplyQuota)
+	assert.Equal(t, 99, ready.ErplyQuota.Remaining)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, w.Body.String(), "# TYPE erply_quota_remaining gauge\nerply_quota_remaining 99\n")
+	assert.Contains(t, w.Body.String(), "erply_quota_used 1\n")
+	assert.Contains(t, w.Body.String(), "erply_quota_shared 1\n")
+}
+
+func TestRedisCounterStopsAtLimit(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	counter := quota.NewRedisCounter(client, prefix)
+	ctx := context.Background()
+
+	for i := 1; i <= 2; i++ {
+		taken, used, err := counter.Take(ctx, "k", 1, 2, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, taken)
+		assert.Equal(t, i, used)
+	}
+	taken, used, err := counter.Take(ctx, "k", 1, 2, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	assert.Equal(t, 2, used)
+	n, err := counter.Count(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestRedisCounterTakesCost(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	counter := quota.NewRedisCounter(client, prefix)
+	ctx := context.Background()
+
+	taken, used, err := counter.Take(ctx, "k", 3, 4, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	assert.Equal(t, 3, used)
+	taken, used, err = counter.Take(ctx, "k", 2, 4, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	assert.Equal(t, 3, used)
+	ttl, err := client.PTTL(ctx, prefix+"k").Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, 50*time.Second)
+}
+
+func TestRedisCounterRecordsPastLimit(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	counter := quota.NewRedisCounter(client, prefix)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		taken, used, err := counter.Take(ctx, "k", 1, -1, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, taken)
+		assert.Equal(t, i, used)
+	}
+	taken, _, err := counter.Take(ctx, "k", 1, 2, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, taken)
+}
+
+func TestRedisCountersShareKeys(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	other := redis.NewClient(&redis.Options{Addr: client.Options().Addr})
+	defer other.Close()
+	replicaA := quota.NewRedisCounter(client, prefix)
+	replicaB := quota.NewRedisCounter(other, prefix)
+	ctx := context.Background()
+
+	_, _, err := replicaA.Take(ctx, "k", 1, 2, time.Minute)
+	require.NoError(t, err)
+	taken, used, err := replicaB.Take(ctx, "k", 1, 2, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	assert.Equal(t, 2, used)
+	taken, _, err = replicaA.Take(ctx, "k", 1, 2, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, taken)
+
+	// Raise by one replica exhausts the key for all.
+	require.NoError(t, replicaA.Raise(ctx, "other", 5, time.Minute))
+	taken, used, err = replicaB.Take(ctx, "other", 1, 5, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, taken)
+	assert.Equal(t, 5, used)
+}
+
+func TestRedisCounterExpires(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	counter := quota.NewRedisCounter(client, prefix)
+	ctx := context.Background()
+
+	_, _, err := counter.Take(ctx, "k", 1, 1, 100*time.Millisecond)
+	require.NoError(t, err)
+	// Later calls do not extend the window.
+	time.Sleep(60 * time.Millisecond)
+	_, _, err = counter.Take(ctx, "k", 1, 1, time.Minute)
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+
+	n, err := counter.Count(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	taken, used, err := counter.Take(ctx, "k", 1, 1, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	assert.Equal(t, 1, used)
+}
+
+func TestRedisGovernorCountsPerHour(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	g := quota.NewGovernor(quota.NewRedisCounter(client, prefix), "acme", quota.Config{Limit: 10}, logger.NewSlogLogger())
+	ctx := context.Background()
+	if time.Until(time.Now().Truncate(time.Hour).Add(time.Hour)) < time.Second {
+		t.Skip("too close to the quota reset")
+	}
+
+	require.NoError(t, g.Acquire(ctx, 1))
+	hourEnd := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	key := prefix + "acme:" + time.Now().UTC().Truncate(time.Hour).Format("2006010215")
+	n, err := client.Get(ctx, key).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// The count of an hour is dropped shortly after it ends, when the next
+	// hour starts from a new key.
+	ttl, err := client.PTTL(ctx, key).Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Until(hourEnd)+time.Minute, ttl, float64(time.Second))
+	assert.Equal(t, 1, g.Status(ctx).Used)
+	assert.True(t, g.Status(ctx).Shared)
+}
@@ -0,0 +1,308 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"erply_test/internal/app"
+	"erply_test/internal/auth"
+	"erply_test/internal/erplyerr"
+	"erply_test/internal/logger"
+	"erply_test/internal/middleware"
+	"erply_test/internal/ratelimit"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("30/m")
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Limit{Count: 30, Per: time.Minute}, limit)
+	assert.Equal(t, "30/m", limit.String())
+
+	for _, s := range []string{"", "30", "0/m", "-1/s", "x/m", "30/d"} {
+		_, err := ratelimit.ParseLimit(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRateLimitRoutesFromEnv(t *testing.T) {
+	var cfg app.Config
+	require.NoError(t, env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{}}))
+	assert.Equal(t, map[string]string{"POST /api/customers/save": "30/m", "DELETE /api/customers/delete": "30/m"}, cfg.RateLimitRoutes)
+}
+
+// newRateLimitedRouter sets the principal from the X-Principal header, if
+// any, and limits like the app does.
+func newRateLimitedRouter(store ratelimit.Store, limits ratelimit.Limits) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if p := c.GetHeader("X-Principal"); p != "" {
+			c.Set(middleware.PrincipalIDKey, p)
+		}
+	})
+	router.Use(middleware.RateLimitMiddleware(ratelimit.NewLimiter(store, limits, logger.NewSlogLogger())))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/customers", ok)
+	router.POST("/api/customers/save", ok)
+	return router
+}
+
+func limitedRequest(router *gin.Engine, method, path, principal, ip string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if principal != "" {
+		req.Header.Set("X-Principal", principal)
+	}
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore(), ratelimit.Limits{Default: ratelimit.Limit{Count: 2, Per: time.Minute}})
+
+	w := limitedRequest(router, http.MethodGet, "/api/customers", "apikey:a", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("X-RateLimit-Reset"))
+
+	limitedRequest(router, http.MethodGet, "/api/customers", "apikey:a", "10.0.0.1")
+	w = limitedRequest(router, http.MethodGet, "/api/customers", "apikey:a", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 30, retryAfter, 1)
+	var body erplyerr.Body
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, erplyerr.KindRateLimited, body.Code)
+
+	// Other principals, and clients without one, have their own buckets.
+	assert.Equal(t, http.StatusOK, limitedRequest(router, http.MethodGet, "/api/customers", "apikey:b", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(router, http.MethodGet, "/api/customers", "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(router, http.MethodGet, "/api/customers", "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, limitedRequest(router, http.MethodGet, "/api/customers", "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(router, http.MethodGet, "/api/customers", "", "10.0.0.2").Code)
+}
+
+func TestRateLimitPerRoute(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore(), ratelimit.Limits{
+		Default: ratelimit.Limit{Count: 5, Per: time.Minute},
+		Routes:  map[string]ratelimit.Limit{"POST /api/customers/save": {Count: 1, Per: time.Minute}},
+	})
+
+	assert.Equal(t, http.StatusOK, limitedRequest(router, http.MethodPost, "/api/customers/save", "apikey:a", "10.0.0.1").Code)
+	w := limitedRequest(router, http.MethodPost, "/api/customers/save", "apikey:a", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	w = limitedRequest(router, http.MethodGet, "/api/customers", "apikey:a", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestIPRateLimitBeforeAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.IPRateLimitMiddleware(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{Default: ratelimit.Limit{Count: 2, Per: time.Minute}}, logger.NewSlogLogger())))
+	router.Use(middleware.APIKeyAuthMiddleware(newKeyStore(t, auth.NewAPIKey("test", "valid_key", auth.AllScopes...))))
+	router.GET("/api/customers", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	guess := func(key, ip string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/api/customers", nil)
+		req.Header.Set("X-API-KEY", key)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, guess("guess1", "10.0.0.1"))
+	assert.Equal(t, http.StatusUnauthorized, guess("guess2", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, guess("guess3", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, guess("valid_key", "10.0.0.1"))
+	assert.Equal(t, http.StatusOK, guess("valid_key", "10.0.0.2"))
+}
+
+func TestIPRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limit := ratelimit.Limits{Default: ratelimit.Limit{Count: 1, Per: time.Hour}}
+	request := func(router *gin.Engine, peer, forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/api/customers", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = peer + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	newRouter := func(config *app.Config) *gin.Engine {
+		router := app.NewRouter(config)
+		router.Use(middleware.IPRateLimitMiddleware(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limit, logger.NewSlogLogger())))
+		router.GET("/api/customers", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return router
+	}
+
+	router := newRouter(&app.Config{})
+	assert.Equal(t, http.StatusOK, request(router, "203.0.113.7", "10.0.0.1"))
+	for i := 2; i < 20; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, request(router, "203.0.113.7", "10.0.0."+strconv.Itoa(i)))
+	}
+
+	// Behind a trusted proxy each forwarded client has its own bucket.
+	router = newRouter(&app.Config{TrustedProxies: []string{"192.0.2.0/24"}})
+	assert.Equal(t, http.StatusOK, request(router, "192.0.2.1", "10.0.0.1"))
+	assert.Equal(t, http.StatusOK, request(router, "192.0.2.1", "10.0.0.2"))
+	assert.Equal(t, http.StatusTooManyRequests, request(router, "192.0.2.1", "10.0.0.1"))
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Count: 20, Per: time.Second}
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		res, _ := store.Take(ctx, "k", limit)
+		require.True(t, res.Allowed)
+	}
+	res, _ := store.Take(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+	assert.LessOrEqual(t, res.RetryAfter, 50*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	res, _ = store.Take(ctx, "k", limit)
+	assert.True(t, res.Allowed)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimitFallsBackToMemory(t *testing.T) {
+	router := newRateLimitedRouter(failingStore{}, ratelimit.Limits{Default: ratelimit.Limit{Count: 1, Per: time.Minute}})
+	assert.Equal(t, http.StatusOK, limitedRequest(router, http.MethodGet, "/api/customers", "apikey:a", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, limitedRequest(router, http.MethodGet, "/api/customers", "apikey:a", "10.0.0.1").Code)
+}
+
+// newTestRedis connects to the Redis at TEST_REDIS_ADDR and skips the test
+// when it is not set. It returns a key prefix unique to the test, whose keys
+// are deleted afterwards.
+func newTestRedis(t *testing.T) (*redis.Client, string) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	prefix := "test:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	t.Cleanup(func() {
+		ctx := context.Background()
+		keys, _ := client.Keys(ctx, prefix+"*").Result()
+		if len(keys) > 0 {
+			client.Del(ctx, keys...)
+		}
+		client.Close()
+	})
+	return client, prefix
+}
+
+func TestRedisStoreBurst(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	store := ratelimit.NewRedisStore(client, prefix)
+	ctx := context.Background()
+
+	limit := ratelimit.Limit{Count: 3, Per: time.Minute}
+	for i := 2; i >= 0; i-- {
+		res, err := store.Take(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err := store.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.InDelta(t, 20*time.Second, res.RetryAfter, float64(time.Second))
+	assert.InDelta(t, time.Minute, res.Reset, float64(time.Second))
+}
+
+func TestRedisStoreRefills(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	store := ratelimit.NewRedisStore(client, prefix)
+	ctx := context.Background()
+
+	limit := ratelimit.Limit{Count: 20, Per: time.Second}
+	for i := 0; i < 20; i++ {
+		res, err := store.Take(ctx, "k", limit)
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+	}
+	res, err := store.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.LessOrEqual(t, res.RetryAfter, 50*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	res, err = store.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestRedisStoresShareBuckets(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	other := redis.NewClient(&redis.Options{Addr: client.Options().Addr})
+	defer other.Close()
+	replicaA := ratelimit.NewRedisStore(client, prefix)
+	replicaB := ratelimit.NewRedisStore(other, prefix)
+	ctx := context.Background()
+
+	limit := ratelimit.Limit{Count: 3, Per: time.Minute}
+	for i := 0; i < 2; i++ {
+		res, err := replicaA.Take(ctx, "k", limit)
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+	}
+	res, err := replicaB.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res, err = replicaA.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// Other keys have their own buckets.
+	res, err = replicaB.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestRedisStoreBucketExpires(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	store := ratelimit.NewRedisStore(client, prefix)
+	ctx := context.Background()
+
+	// One token of 10/s is back after 100ms; the bucket is kept a second
+	// longer.
+	_, err := store.Take(ctx, "k", ratelimit.Limit{Count: 10, Per: time.Second})
+	require.NoError(t, err)
+	ttl, err := client.PTTL(ctx, prefix+"k").Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+	assert.LessOrEqual(t, ttl, 1100*time.Millisecond)
+
+	time.Sleep(1200 * time.Millisecond)
+	n, err := client.Exists(ctx, prefix+"k").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"erply_test/internal/auth"
+	"erply_test/internal/logger"
+	"erply_test/internal/middleware"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	assert.True(t, auth.RoleAdmin.Includes(auth.RoleEditor))
+	assert.True(t, auth.RoleEditor.Includes(auth.RoleReadOnly))
+	assert.True(t, auth.RoleEditor.Includes(auth.RoleEditor))
+	assert.False(t, auth.RoleEditor.Includes(auth.RoleAdmin))
+	assert.False(t, auth.Role("").Includes(auth.RoleReadOnly))
+
+	_, err := auth.ParseRole("owner")
+	assert.Error(t, err)
+}
+
+func TestParseAPIKeysRole(t *testing.T) {
+	keys, err := auth.ParseAPIKeys([]byte(fmt.Sprintf(`{"keys":[{"name":"a","hash":%q},{"name":"b","hash":%q,"role":"editor"}]}`,
+		auth.HashKey("a"), auth.HashKey("b"))))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleReadOnly, keys[0].Role)
+	assert.Equal(t, auth.RoleEditor, keys[1].Role)
+
+	_, err = auth.ParseAPIKeys([]byte(fmt.Sprintf(`{"keys":[{"name":"a","hash":%q,"role":"owner"}]}`, auth.HashKey("a"))))
+	assert.Error(t, err)
+}
+
+func TestParseAPIKeysRoleFromScopes(t *testing.T) {
+	// Key files from before roles keep the access their scopes granted.
+	keys, err := auth.ParseAPIKeys([]byte(fmt.Sprintf(`{"keys":[
+		{"name":"w","hash":%q,"scopes":["customers:read","customers:write"]},
+		{"name":"d","hash":%q,"scopes":["customers:read","customers:delete"]},
+		{"name":"r","hash":%q,"scopes":["customers:read"]}]}`,
+		auth.HashKey("w"), auth.HashKey("d"), auth.HashKey("r"))))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleEditor, keys[0].Role)
+	assert.Equal(t, auth.RoleAdmin, keys[1].Role)
+	assert.Equal(t, auth.RoleReadOnly, keys[2].Role)
+	assert.Equal(t, auth.RoleAdmin, auth.NewAPIKey("all", "secret", auth.AllScopes...).Role)
+}
+
+// newRBACRouter guards routes like the app does and echoes the principal ID
+// the handler sees.
+func newRBACRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	var keys []auth.APIKey
+	for _, role := range []auth.Role{auth.RoleReadOnly, auth.RoleEditor, auth.RoleAdmin} {
+		key := auth.NewAPIKey(string(role), string(role)+"-secret", auth.AllScopes...)
+		key.Role = role
+		keys = append(keys, key)
+	}
+	log := logger.NewSlogLogger()
+	router := gin.New()
+	router.Use(middleware.APIKeyAuthMiddleware(newKeyStore(t, keys...)))
+	echo := func(c *gin.Context) { c.String(http.StatusOK, c.GetString(middleware.PrincipalIDKey)) }
+	router.GET("/api/customers", middleware.Authorize(log, auth.ScopeCustomersRead, auth.RoleReadOnly), echo)
+	router.POST("/api/customers", middleware.Authorize(log, auth.ScopeCustomersWrite, auth.RoleEditor), echo)
+	router.DELETE("/api/customers/:id", middleware.Authorize(log, auth.ScopeCustomersDelete, auth.RoleAdmin), echo)
+	return router
+}
+
+func TestAuthorizeRoles(t *testing.T) {
+	router := newRBACRouter(t)
+	routes := []struct{ method, path string }{
+		{http.MethodGet, "/api/customers"},
+		{http.MethodPost, "/api/customers"},
+		{http.MethodDelete, "/api/customers/7"},
+	}
+	allowed := map[string]int{"read-only": 1, "editor": 2, "admin": 3}
+
+	for role, n := range allowed {
+		for i, route := range routes {
+			req, _ := http.NewRequest(route.method, route.path, nil)
+			req.Header.Set("X-API-KEY", role+"-secret")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if i < n {
+				assert.Equal(t, http.StatusOK, w.Code, role, route.method)
+				assert.Equal(t, "apikey:"+role, w.Body.String())
+			} else {
+				assert.Equal(t, http.StatusForbidden, w.Code, role, route.method)
+			}
+		}
+	}
+}
+
+func TestAuthorizeDenialReason(t *testing.T) {
+	router := newRBACRouter(t)
+	req, _ := http.NewRequest(http.MethodDelete, "/api/customers/7", nil)
+	req.Header.Set("X-API-KEY", "editor-secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]string{
+		"error":  "Forbidden",
+		"reason": "DELETE /api/customers/:id needs role admin, apikey:editor has role editor",
+	}, body)
+}
+
+func TestJWTRoles(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier := newTestVerifier(t, signer)
+
+	claims := validClaims()
+	claims["roles"] = []string{"crm-readers", "crm-admins", "unrelated"}
+	principal, err := verifier.Verify(context.Background(), signer.sign(t, "rsa1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, principal.Role)
+
+	// Without a known role the token gets the role its scopes need.
+	claims["roles"] = []string{"unrelated"}
+	claims["scope"] = "crm.read"
+	principal, err = verifier.Verify(context.Background(), signer.sign(t, "rsa1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleReadOnly, principal.Role)
+
+	delete(claims, "roles")
+	claims["scope"] = "crm.read customers:delete"
+	principal, err = verifier.Verify(context.Background(), signer.sign(t, "rsa1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, principal.Role)
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"context"
+	"erply_test/internal/logger"
+	cache "erply_test/internal/repository"
+	"erply_test/internal/service"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erply/api-go-wrapper/pkg/api/customers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemoryCache(t *testing.T) *cache.MemoryCache {
+	c := cache.NewMemoryCache(100, time.Minute)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// encodeCached encodes v the way CustomerService caches it.
+func encodeCached(t *testing.T, v any) string {
+	codec, err := cache.NewCodec(cache.CompressionNone, 0)
+	require.NoError(t, err)
+	data, err := codec.Encode(v, service.CacheSchemaVersion)
+	require.NoError(t, err)
+	return data
+}
+
+func cacheCustomerEntry(t *testing.T, c cache.CacheInterface, cust service.Customer, fetchedAt time.Time) {
+	data := encodeCached(t, service.CustomerEntry{Customer: cust, FetchedAt: fetchedAt})
+	require.NoError(t, c.Set(context.Background(), "customer:"+strconv.Itoa(cust.ID), data, time.Hour))
+}
+
+func TestGetCustomerConcurrentMissesShareOneFetch(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	svc := service.NewCustomerService(mockManager, newMemoryCache(t), logger.NewSlogLogger())
+
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { time.Sleep(50 * time.Millisecond) }).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, _, err := svc.GetCustomer(context.Background(), 7, service.ReadOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, "Anna", entry.Customer.FirstName)
+		}()
+	}
+	wg.Wait()
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestGetCustomerSharedFetchSurvivesFirstCallerLeaving(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	svc := service.NewCustomerService(mockManager, newMemoryCache(t), logger.NewSlogLogger())
+
+	started := make(chan struct{})
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			assert.NoError(t, args.Get(0).(context.Context).Err())
+		}).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil)
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, _, err := svc.GetCustomer(first, 7, service.ReadOptions{})
+		firstErr <- err
+	}()
+	<-started
+
+	second := make(chan error)
+	go func() {
+		entry, _, err := svc.GetCustomer(context.Background(), 7, service.ReadOptions{})
+		assert.Equal(t, "Anna", entry.Customer.FirstName)
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	assert.NoError(t, <-second)
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestGetCustomerFillDoesNotOutliveWrite(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	svc := service.NewCustomerService(mockManager, c, logger.NewSlogLogger())
+
+	started, release := make(chan struct{}), make(chan struct{})
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Anna"}), nil).Once()
+	mockManager.On("DeleteCustomerBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(customers.DeleteCustomersResponseBulk{BulkItems: []customers.DeleteCustomerResponseBulkItem{okDeleteItem()}}, nil)
+
+	read := make(chan error)
+	go func() {
+		_, _, err := svc.GetCustomer(context.Background(), 7, service.ReadOptions{})
+		read <- err
+	}()
+	<-started
+	// The customer is deleted while the read is fetching it.
+	require.NoError(t, svc.DeleteCustomer(context.Background(), 7))
+	close(release)
+	require.NoError(t, <-read)
+
+	val, err := c.Get(context.Background(), "customer:7")
+	assert.NoError(t, err)
+	assert.Empty(t, val)
+}
+
+func TestGetCustomerWaitsForLockHolder(t *testing.T) {
+	ctx := context.Background()
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	svc := service.NewCustomerService(mockManager, c, logger.NewSlogLogger())
+
+	// Another replica is fetching customer 7.
+	ok, _ := c.TryLock(ctx, "lock:customer:7", "other", time.Minute)
+	require.True(t, ok)
+	data := encodeCached(t, service.CustomerEntry{Customer: service.Customer{ID: 7, FirstName: "Anna"}, FetchedAt: time.Now()})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = c.Set(ctx, "customer:7", data, time.Hour)
+	}()
+
+	entry, source, err := svc.GetCustomer(ctx, 7, service.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, service.SourceCache, source)
+	assert.Equal(t, "Anna", entry.Customer.FirstName)
+	mockManager.AssertNotCalled(t, "GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetCustomerServesStaleWhileRevalidating(t *testing.T) {
+	ctx := context.Background()
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	svc := service.NewCustomerService(mockManager, c, logger.NewSlogLogger(),
+		service.WithStaleWhileRevalidate(time.Hour))
+
+	cacheCustomerEntry(t, c, service.Customer{ID: 7, FirstName: "Anna"}, time.Now().Add(-service.CacheTTL-time.Minute))
+	mockManager.On("GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything).
+		Return(getCustomerResponse(customers.Customer{ID: 7, FirstName: "Berta"}), nil)
+
+	entry, source, err := svc.GetCustomer(ctx, 7, service.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, service.SourceStale, source)
+	assert.Equal(t, "Anna", entry.Customer.FirstName)
+
+	assert.Eventually(t, func() bool {
+		entry, source, _ := svc.GetCustomer(ctx, 7, service.ReadOptions{})
+		return source == service.SourceCache && entry.Customer.FirstName == "Berta"
+	}, time.Second, 10*time.Millisecond)
+	mockManager.AssertNumberOfCalls(t, "GetCustomersBulk", 1)
+}
+
+func TestGetCustomerWithoutStaleWindowServesOldEntry(t *testing.T) {
+	mockManager := new(MockCustomerManager)
+	c := newMemoryCache(t)
+	svc := service.NewCustomerService(mockManager, c, logger.NewSlogLogger())
+
+	cacheCustomerEntry(t, c, service.Customer{ID: 7, FirstName: "Anna"}, time.Now().Add(-service.CacheTTL-time.Minute))
+
+	_, source, err := svc.GetCustomer(context.Background(), 7, service.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, service.SourceCache, source)
+	mockManager.AssertNotCalled(t, "GetCustomersBulk", mock.Anything, mock.Anything, mock.Anything)
+}
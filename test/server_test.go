@@ -0,0 +1,82 @@
+package test
+
+import (
+	"context"
+	"erply_test/internal/app"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowServer serves a handler that signals started and then takes delay.
+func slowServer(t *testing.T, delay time.Duration) (*http.Server, net.Listener, chan struct{}) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started := make(chan struct{}, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(delay)
+		_, _ = io.WriteString(w, "done")
+	})}
+	return srv, ln, started
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	srv, ln, started := slowServer(t, 200*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- app.Serve(ctx, srv, ln, 5*time.Second) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	resp := make(chan result, 1)
+	go func() {
+		r, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			resp <- result{err: err}
+			return
+		}
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		resp <- result{string(body), err}
+	}()
+	<-started
+	cancel()
+
+	res := <-resp
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-served)
+
+	_, err := http.Get("http://" + ln.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestServeCutsOffRequestsAfterDeadline(t *testing.T) {
+	srv, ln, started := slowServer(t, 2*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- app.Serve(ctx, srv, ln, 50*time.Millisecond) }()
+
+	go func() {
+		if r, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			r.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after the drain timeout")
+	}
+}
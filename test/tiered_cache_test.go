@@ -0,0 +1,190 @@
+package test
+
+import (
+	"context"
+	cache "erply_test/internal/repository"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBus delivers published keys to every other subscribed endpoint,
+// like the Redis pub/sub bus does between instances.
+type memoryBus struct {
+	mu   sync.Mutex
+	subs map[*memoryBusEndpoint]func([]string)
+}
+
+type memoryBusEndpoint struct {
+	bus    *memoryBus
+	resets chan func()
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{subs: map[*memoryBusEndpoint]func([]string){}}
+}
+
+func (b *memoryBus) endpoint() *memoryBusEndpoint {
+	return &memoryBusEndpoint{bus: b, resets: make(chan func(), 1)}
+}
+
+func (e *memoryBusEndpoint) Publish(ctx context.Context, keys []string) error {
+	e.bus.mu.Lock()
+	defer e.bus.mu.Unlock()
+	for sub, evict := range e.bus.subs {
+		if sub != e {
+			evict(keys)
+		}
+	}
+	return nil
+}
+
+func (e *memoryBusEndpoint) Subscribe(ctx context.Context, evict func([]string), reset func()) {
+	e.bus.mu.Lock()
+	e.bus.subs[e] = evict
+	e.bus.mu.Unlock()
+	e.resets <- reset
+
+	<-ctx.Done()
+	e.bus.mu.Lock()
+	delete(e.bus.subs, e)
+	e.bus.mu.Unlock()
+}
+
+// newTieredPair returns two instances sharing one L2 and bus. The returned
+// reset funcs simulate a bus reconnect on each instance.
+func newTieredPair(t *testing.T) (*cache.TieredCache, *cache.TieredCache, *cache.MemoryCache, []func()) {
+	l2 := cache.NewMemoryCache(100, time.Minute)
+	bus := newMemoryBus()
+	var caches []*cache.TieredCache
+	var resets []func()
+	for i := 0; i < 2; i++ {
+		ep := bus.endpoint()
+		c := cache.NewTieredCache(cache.NewMemoryCache(100, time.Minute), l2, ep, time.Minute)
+		resets = append(resets, <-ep.resets)
+		caches = append(caches, c)
+		t.Cleanup(func() { c.Close() })
+	}
+	return caches[0], caches[1], l2, resets
+}
+
+func TestTieredCacheConformance(t *testing.T) {
+	testCacheConformance(t, func(t *testing.T) cache.CacheInterface {
+		c, _, _, _ := newTieredPair(t)
+		return c
+	})
+}
+
+func TestTieredCacheServesFromL1(t *testing.T) {
+	ctx := context.Background()
+	a, _, l2, _ := newTieredPair(t)
+
+	require.NoError(t, a.Set(ctx, "k", "v1", time.Minute))
+	// Changed behind the tiered cache's back: L1 still answers.
+	require.NoError(t, l2.Set(ctx, "k", "v2", time.Minute))
+
+	val, err := a.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", val)
+}
+
+func TestTieredCacheDeleteEvictsOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	a, b, l2, _ := newTieredPair(t)
+
+	require.NoError(t, l2.Set(ctx, "k", "v1", time.Minute))
+	val, _ := b.Get(ctx, "k")
+	require.Equal(t, "v1", val)
+
+	require.NoError(t, a.Delete(ctx, "k"))
+	val, err := b.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "", val)
+}
+
+func TestTieredCacheSetEvictsOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	a, b, _, _ := newTieredPair(t)
+
+	require.NoError(t, a.Set(ctx, "k", "v1", time.Minute))
+	val, _ := b.Get(ctx, "k")
+	require.Equal(t, "v1", val)
+
+	require.NoError(t, a.Set(ctx, "k", "v2", time.Minute))
+	val, err := b.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", val)
+}
+
+func TestTieredCacheInvalidateTagsEvictsOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	a, b, _, _ := newTieredPair(t)
+
+	require.NoError(t, a.SetWithTags(ctx, "page1", "v", time.Minute, "customer:7"))
+	require.NoError(t, a.SetWithTags(ctx, "page2", "v", time.Minute, "customer:8"))
+	for _, key := range []string{"page1", "page2"} {
+		val, _ := b.Get(ctx, key)
+		require.Equal(t, "v", val)
+	}
+
+	require.NoError(t, a.InvalidateTags(ctx, "customer:7"))
+	val, _ := b.Get(ctx, "page1")
+	assert.Equal(t, "", val)
+	val, _ = b.Get(ctx, "page2")
+	assert.Equal(t, "v", val)
+}
+
+func TestTieredCacheResetClearsL1(t *testing.T) {
+	ctx := context.Background()
+	a, _, l2, resets := newTieredPair(t)
+
+	require.NoError(t, a.Set(ctx, "k", "v1", time.Minute))
+	require.NoError(t, l2.Set(ctx, "k", "v2", time.Minute))
+	resets[0]()
+
+	val, err := a.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", val)
+}
+
+// TestRedisTieredCacheDeleteEvictsOtherInstances runs two tiered caches
+// against the Redis at TEST_REDIS_ADDR and is skipped when it is not set.
+func TestRedisTieredCacheDeleteEvictsOtherInstances(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	ctx := context.Background()
+	channel := "test:invalidate:" + time.Now().Format(time.RFC3339Nano)
+	newInstance := func() *cache.TieredCache {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		require.NoError(t, client.Ping(ctx).Err())
+		c := cache.NewTieredCache(cache.NewMemoryCache(100, time.Minute), cache.NewRedisCache(client),
+			cache.NewRedisInvalidationBus(client, channel), time.Minute)
+		t.Cleanup(func() {
+			c.Close()
+			client.Close()
+		})
+		return c
+	}
+	a, b := newInstance(), newInstance()
+	key := channel + ":k"
+
+	require.NoError(t, a.Set(ctx, key, "v1", time.Minute))
+	// Wait until b is subscribed and its L1 holds the value.
+	assert.Eventually(t, func() bool {
+		val, _ := b.Get(ctx, key)
+		return val == "v1"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, a.Delete(ctx, key))
+	assert.Eventually(t, func() bool {
+		val, _ := b.Get(ctx, key)
+		return val == ""
+	}, time.Second, 10*time.Millisecond)
+}